@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/go-logr/zapr"
 	"go.uber.org/zap"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jlewi/gctl/gsuite"
 	"github.com/jlewi/monogo/helpers"
@@ -21,15 +24,45 @@ func NewMailCmd() *cobra.Command {
 
 	cmd.AddCommand(NewMailSearchCmd())
 	cmd.AddCommand(NewMailGetCmd())
+	cmd.AddCommand(NewMailThreadCmd())
+	cmd.AddCommand(NewMailAttachmentsCmd())
+	cmd.AddCommand(NewMailSendCmd())
+	cmd.AddCommand(NewMailReplyCmd())
+	cmd.AddCommand(NewMailForwardCmd())
+	cmd.AddCommand(NewMailDraftsCmd())
+	cmd.AddCommand(NewMailLabelsCmd())
+	cmd.AddCommand(NewMailLabelCmd())
+	cmd.AddCommand(NewMailModifyCmd())
+	cmd.AddCommand(NewMailExportCmd())
+	cmd.AddCommand(NewMailSyncCmd())
+	cmd.AddCommand(NewMailIndexCmd())
+	cmd.AddCommand(NewMailWatchCmd())
+	cmd.AddCommand(NewMailFiltersCmd())
+	cmd.AddCommand(NewMailSubscriptionsCmd())
+	cmd.AddCommand(NewMailStatsCmd())
+	cmd.AddCommand(NewMailVacationCmd())
+	cmd.AddCommand(NewMailSendAsCmd())
+	cmd.AddCommand(NewMailSignatureCmd())
+	cmd.AddCommand(NewMailImportCmd())
+	cmd.AddCommand(NewMailMergeCmd())
 	return cmd
 }
 
 func NewMailSearchCmd() *cobra.Command {
 	var maxResults int64
 	var pageToken string
+	var workers int
+	var all bool
+	var tokenFile string
+	var local bool
+	var headers []string
+	var from, to, subject, after, before string
+	var labels []string
+	var unread, hasAttachment bool
 	cmd := &cobra.Command{
-		Use:  "search <query>",
-		Args: cobra.ExactArgs(1),
+		Use:   "search [query]",
+		Short: "Search gmail. The query uses gmail's search syntax and is combined with the filter flags",
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := func() error {
 				app := gsuite.NewApp(os.Stdout)
@@ -37,6 +70,56 @@ func NewMailSearchCmd() *cobra.Command {
 					return err
 				}
 
+				q := gsuite.NewQuery()
+				if len(args) > 0 {
+					q.Raw(args[0])
+				}
+				if from != "" {
+					q.From(from)
+				}
+				if to != "" {
+					q.To(to)
+				}
+				if subject != "" {
+					q.Subject(subject)
+				}
+				for _, l := range labels {
+					q.Label(l)
+				}
+				now := time.Now()
+				if after != "" {
+					t, err := gsuite.ParseSearchDate(after, now)
+					if err != nil {
+						return err
+					}
+					q.After(t)
+				}
+				if before != "" {
+					t, err := gsuite.ParseSearchDate(before, now)
+					if err != nil {
+						return err
+					}
+					q.Before(t)
+				}
+				if unread {
+					q.IsUnread()
+				}
+				if hasAttachment {
+					q.HasAttachment()
+				}
+				query := q.String()
+
+				if local {
+					// The index doesn't store whether messages are unread or have attachments.
+					if unread || hasAttachment {
+						return errors.New("--unread and --has-attachment can't be used with --local")
+					}
+					if all {
+						maxResults = 0
+					}
+					return searchIndex(app, query, int(maxResults))
+				}
+
 				if err := app.SetupTokenSource(); err != nil {
 					return err
 				}
@@ -46,18 +129,37 @@ func NewMailSearchCmd() *cobra.Command {
 					return err
 				}
 
-				query := args[0]
-				results, err := inbox.Search(context.Background(), query, maxResults, pageToken)
+				inbox.SetFetchWorkers(workers)
+				inbox.SetExtraHeaders(headers)
 
-				log := zapr.NewLogger(zap.L())
-				if _, err := fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(results)); err != nil {
-					log.Error(err, "Failed to write results to output")
+				if pageToken == "" && tokenFile != "" {
+					pageToken, err = readPageToken(tokenFile)
+					if err != nil {
+						return err
+					}
+				}
+
+				if all {
+					maxResults = 0
 				}
 
+				results, nextPageToken, err := inbox.Search(context.Background(), query, maxResults, pageToken)
 				if err != nil {
 					return errors.Wrapf(err, "Error searching gmail")
 				}
 
+				log := zapr.NewLogger(zap.L())
+				if _, err := fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(results)); err != nil {
+					log.Error(err, "Failed to write results to output")
+				}
+
+				// The token goes to stderr so that stdout is only the results.
+				if nextPageToken != "" {
+					fmt.Fprintf(os.Stderr, "Next page token: %s\n", nextPageToken)
+				}
+				if tokenFile != "" {
+					return writePageToken(tokenFile, nextPageToken)
+				}
 				return nil
 			}()
 
@@ -70,10 +172,66 @@ func NewMailSearchCmd() *cobra.Command {
 
 	cmd.Flags().Int64VarP(&maxResults, "max-results", "m", 25, "Maximum number of results to return")
 	cmd.Flags().StringVarP(&pageToken, "page-token", "p", "", "The page token to use to fetch the next page of results")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	cmd.Flags().BoolVarP(&all, "all", "", false, "Return all matching messages; overrides --max-results")
+	cmd.Flags().BoolVarP(&local, "local", "", false, "Search the local index built by 'gctl mail index' instead of gmail. Supports the from:, to:, subject:, after:, before: and label: operators; --unread and --has-attachment aren't supported")
+	cmd.Flags().StringSliceVarP(&headers, "headers", "", nil, "Comma separated list of extra headers to fetch, e.g. X-Mailer,List-Unsubscribe. They are returned in the Headers field")
+	cmd.Flags().StringVarP(&from, "from", "", "", "Only return messages from this sender")
+	cmd.Flags().StringVarP(&to, "to", "", "", "Only return messages sent to this recipient")
+	cmd.Flags().StringVarP(&subject, "subject", "", "", "Only return messages whose subject contains these words")
+	cmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "Only return messages with this label. Can be repeated; messages must have all the labels")
+	cmd.Flags().StringVarP(&after, "after", "", "", "Only return messages received after this date; e.g. 7d, 2w, 3m, yesterday or 2024/01/31")
+	cmd.Flags().StringVarP(&before, "before", "", "", "Only return messages received before this date; same formats as --after")
+	cmd.Flags().BoolVarP(&unread, "unread", "", false, "Only return unread messages")
+	cmd.Flags().BoolVarP(&hasAttachment, "has-attachment", "", false, "Only return messages with attachments")
+	cmd.Flags().StringVarP(&tokenFile, "token-file", "", "", "File used to resume a search. If --page-token isn't set the search starts from the token in the file and the next page token is saved to it. The file is removed when there are no more results")
 	return cmd
 }
 
+// searchIndex searches the local index and writes the results.
+func searchIndex(app *gsuite.App, query string, maxResults int) error {
+	index, err := gsuite.OpenIndex(app.Config.GetIndexFile())
+	if err != nil {
+		return err
+	}
+	results, err := index.Search(query, maxResults)
+	if err != nil {
+		return errors.Wrapf(err, "Error searching the local index")
+	}
+	fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(results))
+	return nil
+}
+
+// readPageToken reads a page token saved by writePageToken. It returns an empty token if the file doesn't exist.
+func readPageToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read page token from %s", path)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// writePageToken saves the page token to path. If there are no more pages the file is removed.
+func writePageToken(path string, token string) error {
+	if token == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Failed to remove page token file %s", path)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return errors.Wrapf(err, "Failed to write page token to %s", path)
+	}
+	return nil
+}
+
 func NewMailGetCmd() *cobra.Command {
+	var part string
+	var render string
+	var headers []string
 	cmd := &cobra.Command{
 		Use:  "get <message id>",
 		Args: cobra.ExactArgs(1),
@@ -93,11 +251,35 @@ func NewMailGetCmd() *cobra.Command {
 					return err
 				}
 
+				switch part {
+				case "", "text", "html", "tree":
+				default:
+					return errors.Errorf("Invalid value for --part %q; must be one of text, html or tree", part)
+				}
+				switch gsuite.RenderFormat(render) {
+				case "", gsuite.RenderText, gsuite.RenderMarkdown, gsuite.RenderRaw:
+				default:
+					return errors.Errorf("Invalid value for --render %q; must be one of text, markdown or raw", render)
+				}
+				if part != "" && render != "" {
+					return errors.New("--part and --render can't be used together")
+				}
+
+				inbox.SetExtraHeaders(headers)
 				messageID := args[0]
 				results, err := inbox.GetMessage(context.Background(), messageID)
+				if err != nil && results == nil {
+					return errors.Wrapf(err, "Error getting message")
+				}
 
 				log := zapr.NewLogger(zap.L())
-				if _, err := fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(results)); err != nil {
+				if render != "" {
+					body, renderErr := results.Render(gsuite.RenderFormat(render))
+					if renderErr != nil {
+						return renderErr
+					}
+					fmt.Fprintln(app.Out, body)
+				} else if err := writeEmail(app.Out, results, part); err != nil {
 					log.Error(err, "Failed to write results to output")
 				}
 
@@ -115,5 +297,60 @@ func NewMailGetCmd() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVarP(&part, "part", "", "", "Only print part of the message; one of text, html or tree. The default is to print the whole message as JSON")
+	cmd.Flags().StringVarP(&render, "render", "r", "", "Print the body for reading; one of text, markdown or raw. text and markdown convert HTML, drop tracking pixels and collapse quoted replies")
+	cmd.Flags().StringSliceVarP(&headers, "headers", "", nil, "Comma separated list of extra headers to include in the Headers field, e.g. X-Mailer,List-Unsubscribe")
 	return cmd
 }
+
+// writeEmail writes the part of the email selected by part to w.
+func writeEmail(w io.Writer, email *gsuite.Email, part string) error {
+	var err error
+	switch part {
+	case "text":
+		_, err = fmt.Fprintln(w, email.TextBody)
+	case "html":
+		_, err = fmt.Fprintln(w, email.HTMLBody)
+	case "tree":
+		if email.Payload == nil {
+			return nil
+		}
+		email.Payload.Walk(func(p *gsuite.MessagePart, depth int) {
+			if err != nil {
+				return
+			}
+			line := fmt.Sprintf("%s%s %s", strings.Repeat("  ", depth), p.PartID, p.MimeType)
+			if p.Filename != "" {
+				line += fmt.Sprintf(" filename=%q", p.Filename)
+			}
+			if p.ContentID != "" {
+				line += fmt.Sprintf(" cid=%s", p.ContentID)
+			}
+			if !p.IsMultipart() {
+				line += fmt.Sprintf(" size=%d", p.Size)
+			}
+			_, err = fmt.Fprintln(w, line)
+		})
+	default:
+		_, err = fmt.Fprintf(w, "%s\n", helpers.PrettyString(email))
+	}
+	return err
+}
+
+// newInbox loads the configuration and credentials and returns the app along with an Inbox.
+func newInbox() (*gsuite.App, *gsuite.Inbox, error) {
+	app := gsuite.NewApp(os.Stdout)
+	if err := app.LoadConfig(nil); err != nil {
+		return nil, nil, err
+	}
+
+	if err := app.SetupTokenSource(); err != nil {
+		return nil, nil, err
+	}
+
+	inbox, err := gsuite.NewInbox(*app.Config, app.TS)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, inbox, nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailAttachmentsCmd adds commands to deal with attachments
+func NewMailAttachmentsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "attachments",
+	}
+
+	cmd.AddCommand(NewMailAttachmentsListCmd())
+	cmd.AddCommand(NewMailAttachmentsDownloadCmd())
+	return cmd
+}
+
+func NewMailAttachmentsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "list <message id>",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				results, err := inbox.ListAttachments(context.Background(), args[0])
+				if err != nil {
+					return errors.Wrapf(err, "Error listing attachments")
+				}
+
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(results))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to list attachments;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailAttachmentsDownloadCmd() *cobra.Command {
+	var dir string
+	var query string
+	var maxResults int64
+	cmd := &cobra.Command{
+		Use:   "download [message id]",
+		Short: "Download the attachments of a message or of every message matching --query",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				if (len(args) == 1) == (query != "") {
+					return errors.New("Specify either a message id or --query but not both")
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				messageIDs := args
+				if query != "" {
+					messageIDs, err = inbox.ListMessageIDs(ctx, query, maxResults)
+					if err != nil {
+						return errors.Wrapf(err, "Error searching gmail")
+					}
+				}
+
+				for _, id := range messageIDs {
+					paths, err := inbox.SaveAttachments(ctx, id, dir)
+					for _, p := range paths {
+						fmt.Fprintf(app.Out, "%s\n", p)
+					}
+					if err != nil {
+						return errors.Wrapf(err, "Error downloading attachments of message %s", id)
+					}
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to download attachments;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "The directory to save the attachments in")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Download the attachments of every message matching this query")
+	cmd.Flags().Int64VarP(&maxResults, "max-results", "m", 0, "Maximum number of messages to download attachments from when using --query. Defaults to every matching message")
+	return cmd
+}
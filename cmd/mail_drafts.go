@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailDraftsCmd adds commands to deal with drafts
+func NewMailDraftsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "drafts",
+	}
+
+	cmd.AddCommand(NewMailDraftsCreateCmd())
+	cmd.AddCommand(NewMailDraftsListCmd())
+	cmd.AddCommand(NewMailDraftsGetCmd())
+	cmd.AddCommand(NewMailDraftsUpdateCmd())
+	cmd.AddCommand(NewMailDraftsSendCmd())
+	return cmd
+}
+
+func NewMailDraftsCreateCmd() *cobra.Command {
+	flags := &composeFlags{}
+	var replyTo string
+	var replyAll bool
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a draft",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				msg, err := flags.message()
+				if err != nil {
+					return err
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				if replyTo != "" {
+					if err := inbox.PrepareReply(ctx, replyTo, replyAll, msg); err != nil {
+						return err
+					}
+				}
+
+				draft, err := inbox.CreateDraft(ctx, msg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Created draft id: %s\n", draft.ID)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to create draft;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags.add(cmd)
+	cmd.Flags().StringVarP(&replyTo, "reply-to", "", "", "The id of a message to reply to. The recipients, subject and threading headers are set from it")
+	cmd.Flags().BoolVarP(&replyAll, "reply-all", "", false, "When used with --reply-to reply to all the recipients of the message")
+	return cmd
+}
+
+func NewMailDraftsListCmd() *cobra.Command {
+	var maxResults int64
+	var pageToken string
+	var query string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List drafts",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				drafts, nextPageToken, err := inbox.ListDrafts(context.Background(), query, maxResults, pageToken)
+				if err != nil {
+					return errors.Wrapf(err, "Error listing drafts")
+				}
+
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(drafts))
+				// The token goes to stderr so that stdout is only the results.
+				if nextPageToken != "" {
+					fmt.Fprintf(os.Stderr, "Next page token: %s\n", nextPageToken)
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to list drafts;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().Int64VarP(&maxResults, "max-results", "m", 25, "Maximum number of results to return")
+	cmd.Flags().StringVarP(&pageToken, "page-token", "p", "", "The page token to use to fetch the next page of results")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Only return drafts matching this query")
+	return cmd
+}
+
+func NewMailDraftsGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <draft id>",
+		Short: "Show a draft",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				draft, err := inbox.GetDraft(context.Background(), args[0])
+				if err != nil {
+					return errors.Wrapf(err, "Error getting draft")
+				}
+
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(draft))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to get draft;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailDraftsUpdateCmd() *cobra.Command {
+	flags := &composeFlags{}
+	cmd := &cobra.Command{
+		Use:   "update <draft id>",
+		Short: "Change a draft. Only the fields whose flags are passed change; --attach replaces the attachments",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				// Start from the draft so fields that aren't passed, and the headers threading a reply, are kept.
+				msg, err := inbox.GetDraftMessage(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				if err := flags.update(cmd, msg); err != nil {
+					return err
+				}
+
+				draft, err := inbox.UpdateDraft(ctx, args[0], msg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Updated draft id: %s\n", draft.ID)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to update draft;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags.add(cmd)
+	return cmd
+}
+
+func NewMailDraftsSendCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "send <draft id>",
+		Short: "Send a draft",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				sent, err := inbox.SendDraft(context.Background(), args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Sent message id: %s thread id: %s\n", sent.Id, sent.ThreadId)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to send draft;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/spf13/cobra"
+)
+
+func NewMailExportCmd() *cobra.Command {
+	var query string
+	var format string
+	var out string
+	var workers int
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the messages matching a query to an mbox file or a directory of .eml files",
+		Long: `Export the messages matching a query to an mbox file or a directory of .eml files.
+
+A manifest of the exported messages is kept next to the export. Rerunning an export only exports messages that
+aren't in the manifest so it can be used to incrementally update an archive or to resume an export that failed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				inbox.SetFetchWorkers(workers)
+
+				result, err := inbox.Export(context.Background(), query, gsuite.ExportFormat(format), out)
+				if result != nil {
+					fmt.Fprintf(app.Out, "Exported %d messages; skipped %d already exported messages. Manifest: %s\n", result.Exported, result.Skipped, result.Manifest)
+				}
+				return err
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to export mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "The gmail query selecting the messages to export")
+	cmd.Flags().StringVarP(&format, "format", "f", string(gsuite.ExportMbox), "The format to export to; mbox or eml")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "The mbox file or, for eml, the directory to export to")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	helpers.IgnoreError(cmd.MarkFlagRequired("query"))
+	helpers.IgnoreError(cmd.MarkFlagRequired("out"))
+	return cmd
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailFiltersCmd adds commands to manage gmail filters as code
+func NewMailFiltersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "filters",
+		Short: "Manage gmail filters with a YAML file",
+	}
+
+	cmd.AddCommand(NewMailFiltersExportCmd())
+	cmd.AddCommand(NewMailFiltersPlanCmd())
+	cmd.AddCommand(NewMailFiltersApplyCmd())
+	return cmd
+}
+
+func NewMailFiltersExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the mailbox's filters as YAML to stdout",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				filters, err := inbox.ListFilters(context.Background())
+				if err != nil {
+					return err
+				}
+				return gsuite.WriteFilters(app.Out, filters)
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to export filters;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailFiltersPlanCmd() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes apply would make to the mailbox's filters",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				plan, err := planFilters(inbox, file)
+				if err != nil {
+					return err
+				}
+				diff, err := plan.Diff()
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(app.Out, diff)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to plan filters;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "The YAML file with the desired filters")
+	helpers.IgnoreError(cmd.MarkFlagRequired("file"))
+	return cmd
+}
+
+func NewMailFiltersApplyCmd() *cobra.Command {
+	var file string
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Make the mailbox's filters match a YAML file",
+		Long: `Make the mailbox's filters match a YAML file.
+
+The changes are printed before they are applied. Filters that aren't in the file are deleted and labels referenced
+by new filters are created. Gmail filters can't be edited so a changed filter is deleted and recreated.
+
+Deleting filters can't be undone so if the plan deletes any filter nothing is changed unless --yes is passed;
+review the plan and rerun with --yes to apply it.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				plan, err := planFilters(inbox, file)
+				if err != nil {
+					return err
+				}
+				diff, err := plan.Diff()
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(app.Out, diff)
+				if !plan.HasChanges() {
+					return nil
+				}
+				if len(plan.Delete) > 0 && !yes {
+					return errors.Errorf("The plan deletes %d filters; rerun with --yes to apply it", len(plan.Delete))
+				}
+				if err := inbox.ApplyFilters(context.Background(), plan); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Created %d filters and deleted %d filters\n", len(plan.Create), len(plan.Delete))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to apply filters;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "The YAML file with the desired filters")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply plans that delete filters")
+	helpers.IgnoreError(cmd.MarkFlagRequired("file"))
+	return cmd
+}
+
+// planFilters reads the desired filters from file and plans the changes to the mailbox's filters.
+func planFilters(inbox *gsuite.Inbox, file string) (*gsuite.FilterPlan, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s", file)
+	}
+	defer f.Close()
+	desired, err := gsuite.ReadFilters(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read filters from %s", file)
+	}
+	return inbox.PlanFilters(context.Background(), desired)
+}
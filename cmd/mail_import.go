@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/spf13/cobra"
+)
+
+func NewMailImportCmd() *cobra.Command {
+	var labels []string
+	var checkpoint string
+	cmd := &cobra.Command{
+		Use:   "import <file>...",
+		Short: "Import messages from mbox files, .eml files or directories of .eml files",
+		Long: `Import messages from mbox files, .eml files or directories of .eml files. For example
+
+  gctl mail import --label Archive/2019 old.mbox
+
+Messages are added to the mailbox without being sent and keep the dates in their Date headers. Replies are added to
+the thread of the message they reply to if it was imported earlier.
+
+Every imported message is recorded in a checkpoint, by default <first file>.import.jsonl. Rerunning the same import
+skips the messages in the checkpoint so an import that failed part way through can be resumed.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				result, err := inbox.Import(context.Background(), args, gsuite.ImportOptions{Labels: labels, Checkpoint: checkpoint})
+				if result != nil {
+					fmt.Fprintf(app.Out, "Imported %d messages; skipped %d already imported messages. Checkpoint: %s\n", result.Imported, result.Skipped, result.Checkpoint)
+				}
+				return err
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to import mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Label to apply to the imported messages; missing labels are created. Can be repeated")
+	cmd.Flags().StringVarP(&checkpoint, "checkpoint", "", "", "File recording the imported messages. Defaults to <first file>.import.jsonl")
+	return cmd
+}
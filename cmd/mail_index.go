@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/spf13/cobra"
+)
+
+func NewMailIndexCmd() *cobra.Command {
+	var query string
+	var workers int
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Add messages to the local search index",
+		Long: `Add the messages matching a query to the local search index.
+
+The index stores the headers, body and labels of each message so that they can be searched offline with
+'gctl mail search --local'. Messages that are already in the index aren't fetched again but their labels are
+updated, and messages that were deleted or moved to the trash or spam are removed. The index is stored in
+mail.indexFile in the config which defaults to mail-index.gob in the config directory.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				inbox.SetFetchWorkers(workers)
+
+				index, err := gsuite.OpenIndex(app.Config.GetIndexFile())
+				if err != nil {
+					return err
+				}
+				result, err := inbox.UpdateIndex(context.Background(), index, query)
+				fmt.Fprintf(app.Out, "Added %d, updated %d and removed %d messages; the index has %d messages\n", result.Added, result.Updated, result.Removed, index.Len())
+				return err
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to index mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "The gmail query selecting the messages to index. Defaults to all messages")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	return cmd
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailLabelsCmd adds commands to manage labels
+func NewMailLabelsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "labels",
+	}
+
+	cmd.AddCommand(NewMailLabelsListCmd())
+	cmd.AddCommand(NewMailLabelsCreateCmd())
+	cmd.AddCommand(NewMailLabelsDeleteCmd())
+	cmd.AddCommand(NewMailLabelsRenameCmd())
+	return cmd
+}
+
+func NewMailLabelsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List labels",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				labels, err := inbox.ListLabels(context.Background())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(labels))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to list labels;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailLabelsCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a label. Use / to create nested labels; e.g. Vendors/Acme",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				label, err := inbox.CreateLabel(context.Background(), args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(label))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to create label;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailLabelsDeleteCmd() *cobra.Command {
+	var recursive bool
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a label. Messages with the label aren't deleted",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				if err := inbox.DeleteLabel(context.Background(), args[0], recursive); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Deleted label %s\n", args[0])
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to delete label;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Also delete the labels nested under the label")
+	return cmd
+}
+
+func NewMailLabelsRenameCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename <name> <new name>",
+		Short: "Rename a label along with the labels nested under it",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				if err := inbox.RenameLabel(context.Background(), args[0], args[1]); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Renamed label %s to %s\n", args[0], args[1])
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to rename label;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewMailLabelCmd adds commands to apply labels to messages
+func NewMailLabelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "label",
+	}
+
+	cmd.AddCommand(newMailLabelModifyCmd("add", "Add a label to messages"))
+	cmd.AddCommand(newMailLabelModifyCmd("remove", "Remove a label from messages"))
+	return cmd
+}
+
+// newMailLabelModifyCmd returns the command to add or remove a label from messages.
+func newMailLabelModifyCmd(action string, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   action + " <label> <message id>...",
+		Short: short,
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				label := []string{args[0]}
+				var add, remove []string
+				if action == "add" {
+					add = label
+				} else {
+					remove = label
+				}
+
+				if err := inbox.ModifyLabels(context.Background(), args[1:], add, remove); err != nil {
+					return errors.Wrapf(err, "Error modifying labels")
+				}
+				fmt.Fprintf(app.Out, "Modified %d messages\n", len(args)-1)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to %s label;\n %+v\n", action, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewMailMergeCmd() *cobra.Command {
+	var templateFile string
+	var dataFile string
+	var from string
+	var dryRun bool
+	var out string
+	var rate int
+	var logFile string
+	cmd := &cobra.Command{
+		Use:   "merge",
+		Short: "Send a personalized message to each row of a CSV file",
+		Long: `Send a personalized message to each row of a CSV file.
+
+The template is a Go template file defining a "subject" template and a "text" and/or "html" template for the body;
+e.g.
+
+  {{define "subject"}}Welcome to the team {{.name}}{{end}}
+  {{define "text"}}Hi {{.name}}, your first day is {{.start}}.{{end}}
+  {{define "html"}}<p>Hi {{.name}}, your first day is <b>{{.start}}</b>.</p>{{end}}
+
+The first row of the CSV file is the column names; every column can be used in the templates. The email column is
+the recipient. The optional cc and bcc columns add recipients and the optional attachments column lists files to
+attach separated by semicolons; relative paths are relative to the directory of the CSV file.
+
+Every message is rendered before any is sent. Sent messages are recorded in a log, by default <data>.sent.jsonl, and
+rerunning the merge skips messages in the log so a merge that failed part way through can be resumed without
+sending anyone the same message twice, even if the template was changed. Use --dry-run to review the rendered
+messages first.
+
+Messages are identified in the log by their recipients and the optional id column. Rows with the same recipients
+are an error unless they have different ids.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				src, err := os.ReadFile(templateFile)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to read template %s", templateFile)
+				}
+				tmpl, err := gsuite.ParseMergeTemplate(filepath.Base(templateFile), string(src))
+				if err != nil {
+					return err
+				}
+				f, err := os.Open(dataFile)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to open %s", dataFile)
+				}
+				defer f.Close()
+				rows, err := gsuite.ReadMergeData(f)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to read %s", dataFile)
+				}
+				msgs, err := tmpl.Render(rows, filepath.Dir(dataFile))
+				if err != nil {
+					return err
+				}
+
+				if dryRun {
+					for _, m := range msgs {
+						m.Message.From = from
+					}
+					if err := gsuite.WriteMergeEML(msgs, out); err != nil {
+						return err
+					}
+					fmt.Printf("Dry run: wrote %d messages to %s\n", len(msgs), out)
+					return nil
+				}
+
+				if rate < 0 {
+					return errors.Errorf("--rate must be >= 0; got %d", rate)
+				}
+				opts := gsuite.MergeOptions{From: from, Log: logFile}
+				if rate > 0 {
+					opts.Interval = time.Minute / time.Duration(rate)
+				}
+				if opts.Log == "" {
+					opts.Log = dataFile + ".sent.jsonl"
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				result, err := inbox.SendMerge(context.Background(), msgs, opts)
+				if result != nil {
+					fmt.Fprintf(app.Out, "Sent %d messages; skipped %d already sent messages. Log: %s\n", result.Sent, result.Skipped, result.Log)
+				}
+				return err
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to send the mail merge;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&templateFile, "template", "t", "", "Go template file defining the subject and body")
+	cmd.Flags().StringVarP(&dataFile, "data", "d", "", "CSV file with a row for each message")
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias to send from; see 'gctl mail sendas list'. Defaults to the default alias")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Write the rendered messages as .eml files to --out instead of sending them")
+	cmd.Flags().StringVarP(&out, "out", "o", "merge-preview", "Directory to write the rendered messages to with --dry-run")
+	cmd.Flags().IntVarP(&rate, "rate", "", 20, "Maximum number of messages to send per minute; 0 means no limit")
+	cmd.Flags().StringVarP(&logFile, "log", "", "", "File recording the sent messages. Defaults to <data>.sent.jsonl")
+	helpers.IgnoreError(cmd.MarkFlagRequired("template"))
+	helpers.IgnoreError(cmd.MarkFlagRequired("data"))
+	return cmd
+}
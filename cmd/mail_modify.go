@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/spf13/cobra"
+)
+
+func NewMailModifyCmd() *cobra.Command {
+	var query string
+	var dryRun bool
+	var sampleSize int
+	mod := &gsuite.Modification{}
+	cmd := &cobra.Command{
+		Use:   "modify",
+		Short: "Modify all messages matching a query. Runs as a dry run unless --dry-run=false is passed",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				result, err := inbox.ModifyQuery(context.Background(), query, mod, dryRun, sampleSize)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintf(app.Out, "Sample of matched messages:\n%s\n", helpers.PrettyString(result.Sample))
+				if result.Applied {
+					fmt.Fprintf(app.Out, "Modified %d messages\n", result.Matched)
+				} else {
+					fmt.Fprintf(app.Out, "Dry run: %d messages match the query. Rerun with --dry-run=false to modify them\n", result.Matched)
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to modify messages;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "The gmail query selecting the messages to modify")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", true, "Only show how many messages match and a sample of them")
+	cmd.Flags().IntVarP(&sampleSize, "sample", "", 10, "The number of matched messages to show")
+	cmd.Flags().StringArrayVarP(&mod.AddLabels, "add-label", "", nil, "A label to add. Can be repeated")
+	cmd.Flags().StringArrayVarP(&mod.RemoveLabels, "remove-label", "", nil, "A label to remove. Can be repeated")
+	cmd.Flags().BoolVarP(&mod.Archive, "archive", "", false, "Remove the messages from the inbox")
+	cmd.Flags().BoolVarP(&mod.MarkRead, "mark-read", "", false, "Mark the messages as read")
+	cmd.Flags().BoolVarP(&mod.MarkUnread, "mark-unread", "", false, "Mark the messages as unread")
+	cmd.Flags().BoolVarP(&mod.Star, "star", "", false, "Star the messages")
+	cmd.Flags().BoolVarP(&mod.Unstar, "unstar", "", false, "Unstar the messages")
+	cmd.Flags().BoolVarP(&mod.Trash, "trash", "", false, "Move the messages to the trash")
+	cmd.Flags().BoolVarP(&mod.Untrash, "untrash", "", false, "Move the messages out of the trash")
+	helpers.IgnoreError(cmd.MarkFlagRequired("query"))
+	return cmd
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/spf13/cobra"
+)
+
+func NewMailReplyCmd() *cobra.Command {
+	var all bool
+	var from string
+	var bodyFile string
+	var htmlFile string
+	var attachments []string
+	cmd := &cobra.Command{
+		Use:   "reply <message id>",
+		Short: "Reply to a message keeping the reply in the same thread",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				msg := &gsuite.OutgoingMessage{From: from}
+				if err := readBodies(msg, bodyFile, htmlFile); err != nil {
+					return err
+				}
+				if err := addAttachments(msg, attachments); err != nil {
+					return err
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				if err := inbox.PrepareReply(ctx, args[0], all, msg); err != nil {
+					return err
+				}
+
+				sent, err := inbox.Send(ctx, msg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Sent message id: %s thread id: %s\n", sent.Id, sent.ThreadId)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to reply;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&all, "all", "", false, "Reply to all the recipients of the message")
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias to reply from. Defaults to the default alias")
+	addBodyFlags(cmd, &bodyFile, &htmlFile)
+	cmd.Flags().StringArrayVarP(&attachments, "attach", "a", nil, "A file to attach. Can be repeated")
+	return cmd
+}
+
+func NewMailForwardCmd() *cobra.Command {
+	var from string
+	var to []string
+	var cc []string
+	var bcc []string
+	var bodyFile string
+	var htmlFile string
+	var attachments []string
+	cmd := &cobra.Command{
+		Use:   "forward <message id>",
+		Short: "Forward a message including its attachments",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				msg := &gsuite.OutgoingMessage{
+					From: from,
+					To:   to,
+					Cc:   cc,
+					Bcc:  bcc,
+				}
+				if err := readBodies(msg, bodyFile, htmlFile); err != nil {
+					return err
+				}
+				if err := addAttachments(msg, attachments); err != nil {
+					return err
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				if err := inbox.PrepareForward(ctx, args[0], msg); err != nil {
+					return err
+				}
+
+				sent, err := inbox.Send(ctx, msg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Sent message id: %s thread id: %s\n", sent.Id, sent.ThreadId)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to forward;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias to forward from. Defaults to the default alias")
+	cmd.Flags().StringSliceVarP(&to, "to", "", nil, "Recipients")
+	cmd.Flags().StringSliceVarP(&cc, "cc", "", nil, "Cc recipients")
+	cmd.Flags().StringSliceVarP(&bcc, "bcc", "", nil, "Bcc recipients")
+	addBodyFlags(cmd, &bodyFile, &htmlFile)
+	cmd.Flags().StringArrayVarP(&attachments, "attach", "a", nil, "An additional file to attach. Can be repeated")
+	return cmd
+}
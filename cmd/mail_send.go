@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewMailSendCmd() *cobra.Command {
+	flags := &composeFlags{}
+	cmd := &cobra.Command{
+		Use:   "send",
+		Short: "Compose and send an email",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				msg, err := flags.message()
+				if err != nil {
+					return err
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				sent, err := inbox.Send(context.Background(), msg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Sent message id: %s thread id: %s\n", sent.Id, sent.ThreadId)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to send mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags.add(cmd)
+	return cmd
+}
+
+// composeFlags are the flags used to compose a new message.
+type composeFlags struct {
+	from        string
+	to          []string
+	cc          []string
+	bcc         []string
+	subject     string
+	bodyFile    string
+	htmlFile    string
+	attachments []string
+	headers     []string
+}
+
+func (f *composeFlags) add(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.from, "from", "", "", "The send-as alias to send from; see 'gctl mail sendas list'. Defaults to the default alias")
+	cmd.Flags().StringSliceVarP(&f.to, "to", "", nil, "Recipients")
+	cmd.Flags().StringSliceVarP(&f.cc, "cc", "", nil, "Cc recipients")
+	cmd.Flags().StringSliceVarP(&f.bcc, "bcc", "", nil, "Bcc recipients")
+	cmd.Flags().StringVarP(&f.subject, "subject", "s", "", "The subject of the message")
+	addBodyFlags(cmd, &f.bodyFile, &f.htmlFile)
+	cmd.Flags().StringArrayVarP(&f.attachments, "attach", "a", nil, "A file to attach. Can be repeated")
+	cmd.Flags().StringArrayVarP(&f.headers, "header", "", nil, "An additional header in the form \"Name: value\". Can be repeated. Headers set by other flags, e.g. Subject, and the Content-* headers can't be set")
+}
+
+// message returns the message described by the flags.
+func (f *composeFlags) message() (*gsuite.OutgoingMessage, error) {
+	msg := &gsuite.OutgoingMessage{
+		From:    f.from,
+		To:      f.to,
+		Cc:      f.cc,
+		Bcc:     f.bcc,
+		Subject: f.subject,
+	}
+
+	if err := readBodies(msg, f.bodyFile, f.htmlFile); err != nil {
+		return nil, err
+	}
+
+	if err := addAttachments(msg, f.attachments); err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseHeaders(f.headers)
+	if err != nil {
+		return nil, err
+	}
+	msg.Headers = parsed
+	return msg, nil
+}
+
+// update changes the fields of msg whose flags were passed. New bodies replace both versions of the old body and
+// --attach replaces the attachments.
+func (f *composeFlags) update(cmd *cobra.Command, msg *gsuite.OutgoingMessage) error {
+	if cmd.Flags().Changed("from") {
+		msg.From = f.from
+	}
+	if cmd.Flags().Changed("to") {
+		msg.To = f.to
+	}
+	if cmd.Flags().Changed("cc") {
+		msg.Cc = f.cc
+	}
+	if cmd.Flags().Changed("bcc") {
+		msg.Bcc = f.bcc
+	}
+	if cmd.Flags().Changed("subject") {
+		msg.Subject = f.subject
+	}
+	if f.bodyFile != "" || f.htmlFile != "" {
+		msg.TextBody, msg.HTMLBody = "", ""
+		if err := readBodies(msg, f.bodyFile, f.htmlFile); err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("attach") {
+		msg.Attachments = nil
+		if err := addAttachments(msg, f.attachments); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := parseHeaders(f.headers)
+	if err != nil {
+		return err
+	}
+	if msg.Headers == nil {
+		msg.Headers = map[string]string{}
+	}
+	for name, value := range parsed {
+		msg.Headers[name] = value
+	}
+	return nil
+}
+
+// addBodyFlags adds the flags used to read the body of a message.
+func addBodyFlags(cmd *cobra.Command, bodyFile *string, htmlFile *string) {
+	cmd.Flags().StringVarP(bodyFile, "body-file", "b", "", "File containing the plain text body; use - to read from stdin")
+	cmd.Flags().StringVarP(htmlFile, "html-file", "", "", "File containing the HTML body; use - to read from stdin")
+}
+
+// readBodies sets the text and HTML bodies of msg from the files passed on the command line.
+func readBodies(msg *gsuite.OutgoingMessage, bodyFile string, htmlFile string) error {
+	if bodyFile == "-" && htmlFile == "-" {
+		return errors.New("Only one of --body-file and --html-file can be read from stdin")
+	}
+	if bodyFile != "" {
+		b, err := readFileOrStdin(bodyFile)
+		if err != nil {
+			return err
+		}
+		msg.TextBody = b
+	}
+	if htmlFile != "" {
+		b, err := readFileOrStdin(htmlFile)
+		if err != nil {
+			return err
+		}
+		msg.HTMLBody = b
+	}
+	return nil
+}
+
+// readFileOrStdin returns the contents of the file at path. If path is "-" it reads stdin.
+func readFileOrStdin(path string) (string, error) {
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to read stdin")
+		}
+		return string(b), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read file %s", path)
+	}
+	return string(b), nil
+}
+
+// addAttachments reads the files at paths and attaches them to msg.
+func addAttachments(msg *gsuite.OutgoingMessage, paths []string) error {
+	for _, path := range paths {
+		a, err := gsuite.NewAttachmentFromFile(path)
+		if err != nil {
+			return err
+		}
+		msg.Attachments = append(msg.Attachments, a)
+	}
+	return nil
+}
+
+// parseHeaders parses headers in the form "Name: value".
+func parseHeaders(headers []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(headers))
+	for _, h := range headers {
+		pieces := strings.SplitN(h, ":", 2)
+		if len(pieces) != 2 {
+			return nil, errors.Errorf("Invalid header %q; headers must be in the form \"Name: value\"", h)
+		}
+		parsed[strings.TrimSpace(pieces[0])] = strings.TrimSpace(pieces[1])
+	}
+	return parsed, nil
+}
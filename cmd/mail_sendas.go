@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/spf13/cobra"
+)
+
+// NewMailSendAsCmd adds commands to work with send-as aliases
+func NewMailSendAsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sendas",
+		Short: "Work with the addresses you can send mail from",
+	}
+
+	cmd.AddCommand(NewMailSendAsListCmd())
+	return cmd
+}
+
+func NewMailSendAsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the primary address and aliases you can send mail from",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				aliases, err := inbox.ListSendAs(context.Background())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(aliases))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to list send-as aliases;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewMailSignatureCmd adds commands to manage signatures
+func NewMailSignatureCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "signature",
+		Short: "Get or set the signature of a send-as alias",
+	}
+
+	cmd.AddCommand(NewMailSignatureGetCmd())
+	cmd.AddCommand(NewMailSignatureSetCmd())
+	return cmd
+}
+
+func NewMailSignatureGetCmd() *cobra.Command {
+	var from string
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Print the HTML signature of an alias",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				s, err := inbox.GetSendAs(context.Background(), from)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(app.Out, s.Signature)
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to get the signature;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias. Defaults to the default alias")
+	return cmd
+}
+
+func NewMailSignatureSetCmd() *cobra.Command {
+	var from string
+	var file string
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set the HTML signature of an alias from a file",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				signature, err := readFileOrStdin(file)
+				if err != nil {
+					return err
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				if err := inbox.SetSignature(context.Background(), from, signature); err != nil {
+					return err
+				}
+				fmt.Fprintln(app.Out, "Updated the signature")
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to set the signature;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias. Defaults to the default alias")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "File containing the HTML signature; use - to read from stdin. An empty file removes the signature")
+	helpers.IgnoreError(cmd.MarkFlagRequired("file"))
+	return cmd
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewMailStatsCmd() *cobra.Command {
+	var query string
+	var since string
+	var output string
+	var workers int
+	opts := gsuite.StatsOptions{}
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show top senders and recipients, volume, unread backlog, largest messages and response time",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				switch opts.Period {
+				case gsuite.PeriodDay, gsuite.PeriodWeek:
+				default:
+					return errors.Errorf("Invalid value for --period %q; must be day or week", opts.Period)
+				}
+				switch output {
+				case "table", "json":
+				default:
+					return errors.Errorf("Invalid value for --output %q; must be table or json", output)
+				}
+
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				inbox.SetFetchWorkers(workers)
+
+				q := gsuite.NewQuery().Raw(query)
+				if since != "" {
+					t, err := gsuite.ParseSearchDate(since, time.Now())
+					if err != nil {
+						return err
+					}
+					q.After(t)
+				}
+				opts.Query = q.String()
+
+				stats, err := inbox.Stats(context.Background(), opts)
+				if err != nil {
+					return err
+				}
+				if output == "json" {
+					fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(stats))
+					return nil
+				}
+				return writeStatsTable(app.Out, stats, opts.Period)
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to compute stats;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "The gmail query selecting the messages. Sent mail must be included to compute response times")
+	cmd.Flags().StringVarP(&since, "since", "", "30d", "Only include messages received after this date; e.g. 7d, 4w or 2024/01/31. Empty includes all messages")
+	cmd.Flags().StringVarP(&opts.Period, "period", "", gsuite.PeriodDay, "Group message volume by day or week")
+	cmd.Flags().IntVarP(&opts.Top, "top", "", 10, "The number of top senders, recipients and largest messages to show")
+	cmd.Flags().Int64VarP(&opts.MaxResults, "max-results", "m", 5000, "Maximum number of messages to scan; 0 scans all the matching messages")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format; table or json")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	return cmd
+}
+
+// writeStatsTable writes the stats as a set of aligned tables.
+func writeStatsTable(out io.Writer, stats *gsuite.MailStats, period string) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Messages\t%d\n", stats.Messages)
+	if stats.Responses > 0 {
+		fmt.Fprintf(w, "Median response time\t%s (%d replies)\n", stats.MedianResponseTime.Round(time.Minute), stats.Responses)
+	}
+
+	counts := func(title string, header string, counts []*gsuite.Count) {
+		fmt.Fprintf(w, "\n%s\n%s\tMESSAGES\n", title, header)
+		for _, c := range counts {
+			fmt.Fprintf(w, "%s\t%d\n", c.Key, c.Count)
+		}
+	}
+	counts("Top senders", "SENDER", stats.TopSenders)
+	counts("Top recipients", "RECIPIENT", stats.TopRecipients)
+	// The unread backlog covers the whole mailbox rather than only the messages matching the query.
+	counts("Unread by label (whole mailbox)", "LABEL", stats.UnreadByLabel)
+
+	fmt.Fprintf(w, "\nVolume per %s\nSTART\tMESSAGES\n", period)
+	for _, v := range stats.Volume {
+		fmt.Fprintf(w, "%s\t%d\n", v.Start.Format("2006-01-02"), v.Count)
+	}
+
+	fmt.Fprintf(w, "\nLargest messages\nSIZE\tID\tFROM\tSUBJECT\n")
+	for _, m := range stats.Largest {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", formatSize(m.Size), m.ID, m.From, m.Subject)
+	}
+	return w.Flush()
+}
+
+// formatSize formats a size in bytes using binary units; e.g. 1.5 MiB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/spf13/cobra"
+)
+
+// NewMailSubscriptionsCmd adds commands to find and unsubscribe from newsletters and mailing lists
+func NewMailSubscriptionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "subscriptions",
+		Short: "Find and unsubscribe from newsletters and mailing lists",
+	}
+
+	cmd.AddCommand(NewMailSubscriptionsListCmd())
+	cmd.AddCommand(NewMailSubscriptionsUnsubscribeCmd())
+	return cmd
+}
+
+func NewMailSubscriptionsListCmd() *cobra.Command {
+	var query string
+	var maxResults int64
+	var workers int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Group the messages matching a query by List-Id or sender with counts and unsubscribe links",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				inbox.SetFetchWorkers(workers)
+
+				subs, err := inbox.ListSubscriptions(context.Background(), query, maxResults)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(subs))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to list subscriptions;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "newer_than:90d", "The gmail query selecting the messages to scan")
+	cmd.Flags().Int64VarP(&maxResults, "max-results", "m", 1000, "Maximum number of messages to scan; 0 scans all the matching messages")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	return cmd
+}
+
+func NewMailSubscriptionsUnsubscribeCmd() *cobra.Command {
+	var query string
+	var archive bool
+	var dryRun bool
+	var from string
+	cmd := &cobra.Command{
+		Use:   "unsubscribe <list id or sender address>",
+		Short: "Unsubscribe using one-click unsubscribe (RFC 8058) or by sending the requested email",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				ctx := context.Background()
+
+				sub, err := inbox.GetSubscription(ctx, args[0], query)
+				if err != nil {
+					return err
+				}
+				if dryRun {
+					fmt.Fprintf(app.Out, "Dry run: would unsubscribe from\n%s\n", helpers.PrettyString(sub))
+					return nil
+				}
+
+				if err := inbox.Unsubscribe(ctx, sub, from); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "Unsubscribed from %s\n", sub.Key)
+
+				if archive {
+					n, err := inbox.ArchiveSubscription(ctx, sub)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(app.Out, "Archived %d messages\n", n)
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to unsubscribe;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "newer_than:90d", "Only look at messages matching this query when finding the unsubscribe links")
+	cmd.Flags().BoolVarP(&archive, "archive", "", false, "Also remove the sender's messages from the inbox")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Only show the subscription and its unsubscribe links")
+	cmd.Flags().StringVarP(&from, "from", "", "", "The send-as alias to send unsubscribe emails from. Defaults to the default alias")
+	return cmd
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/spf13/cobra"
+)
+
+func NewMailSyncCmd() *cobra.Command {
+	var dir string
+	var workers int
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync the mailbox to a local Maildir",
+		Long: `Sync the mailbox to a local Maildir.
+
+The first sync downloads every message. Later syncs use the gmail history to only download new messages and to
+apply deletions and label changes. If the history has expired, which happens after about a week, a full sync is done
+but messages that are already downloaded aren't downloaded again.
+
+INBOX is the top level Maildir and labels are Maildir++ folders; e.g. Work/Projects is .Work.Projects. Messages
+without a label are in .Archive and messages in the trash or spam aren't synced. Read and starred messages have the
+S and F flags. The sync is one way; changes made to the Maildir aren't applied to gmail.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				inbox.SetFetchWorkers(workers)
+
+				result, err := inbox.SyncMaildir(context.Background(), dir)
+				if result != nil {
+					fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(result))
+				}
+				return err
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to sync mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", "", "The Maildir to sync to")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 0, "Number of messages to fetch concurrently. Defaults to mail.fetchWorkers in the config")
+	helpers.IgnoreError(cmd.MarkFlagRequired("dir"))
+	return cmd
+}
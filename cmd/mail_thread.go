@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailThreadCmd adds commands to deal with gmail conversations
+func NewMailThreadCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "thread",
+	}
+
+	cmd.AddCommand(NewMailThreadGetCmd())
+	cmd.AddCommand(NewMailThreadSearchCmd())
+	return cmd
+}
+
+func NewMailThreadGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "get <thread id>",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				thread, err := inbox.GetThread(context.Background(), args[0])
+				if err != nil {
+					return errors.Wrapf(err, "Error getting thread")
+				}
+
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(thread))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to get thread;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func NewMailThreadSearchCmd() *cobra.Command {
+	var maxResults int64
+	var pageToken string
+	cmd := &cobra.Command{
+		Use:  "search <query>",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				threads, nextPageToken, err := inbox.SearchThreads(context.Background(), args[0], maxResults, pageToken)
+				if err != nil {
+					return errors.Wrapf(err, "Error searching threads")
+				}
+
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(threads))
+				// The token goes to stderr so that stdout is only the results.
+				if nextPageToken != "" {
+					fmt.Fprintf(os.Stderr, "Next page token: %s\n", nextPageToken)
+				}
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to search threads;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().Int64VarP(&maxResults, "max-results", "m", 10, "Maximum number of threads to return")
+	cmd.Flags().StringVarP(&pageToken, "page-token", "p", "", "The page token to use to fetch the next page of results")
+	return cmd
+}
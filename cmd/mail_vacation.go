@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/jlewi/monogo/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewMailVacationCmd adds commands to control the vacation responder
+func NewMailVacationCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vacation",
+		Short: "Show or change the vacation responder (auto-reply)",
+	}
+
+	cmd.AddCommand(NewMailVacationStatusCmd())
+	cmd.AddCommand(NewMailVacationOnCmd())
+	cmd.AddCommand(NewMailVacationOffCmd())
+	return cmd
+}
+
+func NewMailVacationStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the vacation responder settings",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				v, err := inbox.GetVacation(context.Background())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(v))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to get the vacation responder;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+func NewMailVacationOnCmd() *cobra.Command {
+	var subject string
+	var bodyFile string
+	var htmlFile string
+	var start string
+	var end string
+	var contactsOnly bool
+	var domainOnly bool
+	cmd := &cobra.Command{
+		Use:   "on",
+		Short: "Turn on the vacation responder. Settings that aren't passed keep their current values",
+		Long: `Turn on the vacation responder. Settings that aren't passed keep their current values.
+
+An end that has already passed, e.g. one left over from a previous vacation, is cleared so that the responder
+replies until it is turned off. Passing an --end that has already passed is an error.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				ctx := context.Background()
+
+				v, err := inbox.GetVacation(ctx)
+				if err != nil {
+					return err
+				}
+				v.Enabled = true
+				if cmd.Flags().Changed("subject") {
+					v.Subject = subject
+				}
+				if bodyFile != "" || htmlFile != "" {
+					// A new body replaces both versions of the old one.
+					body := &gsuite.OutgoingMessage{}
+					if err := readBodies(body, bodyFile, htmlFile); err != nil {
+						return err
+					}
+					v.TextBody, v.HTMLBody = body.TextBody, body.HTMLBody
+				}
+				if cmd.Flags().Changed("start") {
+					if v.Start, err = parseVacationDate(start, false); err != nil {
+						return err
+					}
+				}
+				if cmd.Flags().Changed("end") {
+					if v.End, err = parseVacationDate(end, true); err != nil {
+						return err
+					}
+				}
+				if !v.End.IsZero() && !v.End.After(time.Now()) {
+					if cmd.Flags().Changed("end") {
+						return errors.Errorf("The end %v has already passed", v.End)
+					}
+					// Otherwise the responder would be turned on but never reply.
+					v.End = time.Time{}
+				}
+				if cmd.Flags().Changed("contacts-only") {
+					v.ContactsOnly = contactsOnly
+				}
+				if cmd.Flags().Changed("domain-only") {
+					v.DomainOnly = domainOnly
+				}
+
+				if err := inbox.SetVacation(ctx, v); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.Out, "%s\n", helpers.PrettyString(v))
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to turn on the vacation responder;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&subject, "subject", "s", "", "The subject of the reply")
+	addBodyFlags(cmd, &bodyFile, &htmlFile)
+	cmd.Flags().StringVarP(&start, "start", "", "", "When to start replying; a date like 2024-07-01 or an RFC 3339 time. Empty starts now")
+	cmd.Flags().StringVarP(&end, "end", "", "", "The last day to reply on; a date like 2024-07-05 or an RFC 3339 time. Empty replies until turned off")
+	cmd.Flags().BoolVarP(&contactsOnly, "contacts-only", "", false, "Only reply to people in your contacts")
+	cmd.Flags().BoolVarP(&domainOnly, "domain-only", "", false, "Only reply to people in your domain (Google Workspace only)")
+	return cmd
+}
+
+func NewMailVacationOffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "off",
+		Short: "Turn off the vacation responder. The message is kept so it can be turned on again",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+				ctx := context.Background()
+				v, err := inbox.GetVacation(ctx)
+				if err != nil {
+					return err
+				}
+				v.Enabled = false
+				if err := inbox.SetVacation(ctx, v); err != nil {
+					return err
+				}
+				fmt.Fprintln(app.Out, "Turned off the vacation responder")
+				return nil
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to turn off the vacation responder;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// parseVacationDate parses a date like 2024-07-01 or 2024/07/01 as midnight local time or an RFC 3339 time. If
+// endOfDay is true a date means the end of that day so the responder replies on the last day too. An empty value
+// is the zero time.
+func parseVacationDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006/01/02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			if endOfDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("Invalid date %q; use a date like 2024-07-01 or an RFC 3339 time", value)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/jlewi/gctl/gsuite"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewMailWatchCmd() *cobra.Command {
+	var query string
+	var interval time.Duration
+	var checkpoint string
+	var command string
+	var webhook string
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch for new and changed messages and print an event for each one",
+		Long: `Watch for new and changed messages and print an event for each one.
+
+The gmail history is polled and a JSON line is printed for each message that is added, deleted or whose labels
+change. The history id that has been processed is saved to the checkpoint file so restarting the watch picks up
+where it left off.
+
+With --exec the command is run with the shell for every event. The event is written to its stdin as JSON and the
+GCTL_EVENT_TYPE and GCTL_MESSAGE_ID environment variables are set. With --webhook the event is POSTed as JSON to the
+URL. Failures of the command or webhook are logged and don't stop the watch.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app, inbox, err := newInbox()
+				if err != nil {
+					return err
+				}
+
+				if checkpoint == "" {
+					checkpoint = filepath.Join(app.Config.GetConfigDir(), "watch-checkpoint")
+				}
+
+				hooks := make([]gsuite.EventHandler, 0, 2)
+				if command != "" {
+					hooks = append(hooks, gsuite.CommandHook(command))
+				}
+				if webhook != "" {
+					hooks = append(hooks, gsuite.WebhookHook(webhook))
+				}
+
+				handler := func(ctx context.Context, event *gsuite.WatchEvent) error {
+					b, err := json.Marshal(event)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to marshal event")
+					}
+					fmt.Fprintf(app.Out, "%s\n", b)
+
+					var hookErr error
+					for _, h := range hooks {
+						if err := h(ctx, event); err != nil {
+							hookErr = err
+						}
+					}
+					return hookErr
+				}
+
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				opts := gsuite.WatchOptions{
+					Query:          query,
+					Interval:       interval,
+					CheckpointFile: checkpoint,
+				}
+				return inbox.Watch(ctx, opts, handler)
+			}()
+
+			if err != nil {
+				fmt.Printf("Failed to watch mail;\n %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&query, "query", "q", "", "Only report messages matching this gmail query. Deleted messages are only reported when there is no query")
+	cmd.Flags().DurationVarP(&interval, "interval", "i", time.Minute, "How often to poll for changes")
+	cmd.Flags().StringVarP(&checkpoint, "checkpoint", "", "", "File storing the last processed history id. Defaults to watch-checkpoint in the config directory")
+	cmd.Flags().StringVarP(&command, "exec", "", "", "Shell command to run for each event")
+	cmd.Flags().StringVarP(&webhook, "webhook", "", "", "URL to POST each event to")
+	return cmd
+}
@@ -38,6 +38,16 @@ type Config struct {
 	Logging Logging `json:"logging" yaml:"logging"`
 	// OAuthClientFile is the path to the JSON file containing the OAuth client secret.
 	OAuthClientFile string `json:"oauthClientFile,omitempty" yaml:"oauthClientFile,omitempty"`
+
+	Mail Mail `json:"mail,omitempty" yaml:"mail,omitempty"`
+}
+
+// Mail is the configuration for gmail.
+type Mail struct {
+	// FetchWorkers is the number of messages to fetch concurrently when fetching search results.
+	FetchWorkers int `json:"fetchWorkers,omitempty" yaml:"fetchWorkers,omitempty"`
+	// IndexFile is the path of the local search index. Defaults to mail-index.gob in the config directory.
+	IndexFile string `json:"indexFile,omitempty" yaml:"indexFile,omitempty"`
 }
 
 type Logging struct {
@@ -59,6 +69,22 @@ func (c *Config) GetLogDir() string {
 	return c.Logging.LogDir
 }
 
+// GetFetchWorkers returns the number of messages to fetch concurrently.
+func (c *Config) GetFetchWorkers() int {
+	if c.Mail.FetchWorkers <= 0 {
+		return 10
+	}
+	return c.Mail.FetchWorkers
+}
+
+// GetIndexFile returns the path of the local mail search index.
+func (c *Config) GetIndexFile() string {
+	if c.Mail.IndexFile == "" {
+		return filepath.Join(c.GetConfigDir(), "mail-index.gob")
+	}
+	return c.Mail.IndexFile
+}
+
 // GetConfigDir returns the configuration directory
 func (c *Config) GetConfigDir() string {
 	configFile := viper.ConfigFileUsed()
@@ -0,0 +1,56 @@
+package gsuite
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Address is an email address parsed from a header such as From or To.
+type Address struct {
+	// Name is the display name with any RFC 2047 encoded words decoded. It is empty if the header only has the
+	// address.
+	Name    string
+	Address string
+}
+
+// addressParser decodes encoded words in any charset, not just the UTF-8 and ISO-8859-1 net/mail supports.
+var addressParser = &mail.AddressParser{
+	WordDecoder: &mime.WordDecoder{CharsetReader: charset.NewReaderLabel},
+}
+
+// ParseAddresses parses the value of an address header (e.g. To or Cc). Members of RFC 5322 groups are returned
+// as individual addresses and empty groups (e.g. "undisclosed-recipients:;") have no addresses. Addresses that can't
+// be parsed are ignored.
+func ParseAddresses(header string) []*Address {
+	parsed := splitAddresses(header)
+	if len(parsed) == 0 {
+		return nil
+	}
+	addrs := make([]*Address, 0, len(parsed))
+	for _, a := range parsed {
+		addrs = append(addrs, &Address{Name: a.Name, Address: a.Address})
+	}
+	return addrs
+}
+
+// splitAddresses parses a header containing a list of addresses. Addresses that can't be parsed are ignored.
+func splitAddresses(header string) []*mail.Address {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	addrs, err := addressParser.ParseList(header)
+	if err == nil {
+		return addrs
+	}
+	// Fall back to parsing each address individually so one malformed address doesn't lose the others.
+	var results []*mail.Address
+	for _, piece := range strings.Split(header, ",") {
+		if a, err := addressParser.Parse(piece); err == nil {
+			results = append(results, a)
+		}
+	}
+	return results
+}
@@ -0,0 +1,68 @@
+package gsuite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseAddresses(t *testing.T) {
+	type testCase struct {
+		name     string
+		header   string
+		expected []*Address
+	}
+	cases := []testCase{
+		{
+			name:   "quoted-comma",
+			header: `"Doe, Jane" <jane@example.com>, bob@example.com`,
+			expected: []*Address{
+				{Name: "Doe, Jane", Address: "jane@example.com"},
+				{Address: "bob@example.com"},
+			},
+		},
+		{
+			name:   "encoded-words",
+			header: `=?UTF-8?Q?J=C3=BCrgen?= <j@example.com>, =?windows-1252?Q?Fran=E7ois?= <f@example.com>, =?ISO-2022-JP?B?GyRCJTUlcyVXJWsbKEI=?= <s@example.jp>`,
+			expected: []*Address{
+				{Name: "Jürgen", Address: "j@example.com"},
+				{Name: "François", Address: "f@example.com"},
+				{Name: "サンプル", Address: "s@example.jp"},
+			},
+		},
+		{
+			name:   "group",
+			header: `Team: a@example.com, B <b@example.com>;, c@example.com`,
+			expected: []*Address{
+				{Address: "a@example.com"},
+				{Name: "B", Address: "b@example.com"},
+				{Address: "c@example.com"},
+			},
+		},
+		{
+			name:     "empty-group",
+			header:   "undisclosed-recipients:;",
+			expected: nil,
+		},
+		{
+			name:   "malformed",
+			header: "Doe, Jane <jane@example.com>, bob@example.com",
+			expected: []*Address{
+				{Name: "Jane", Address: "jane@example.com"},
+				{Address: "bob@example.com"},
+			},
+		},
+		{
+			name:     "empty",
+			header:   " ",
+			expected: nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := ParseAddresses(c.header)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("Got %+v; want %+v", actual, c.expected)
+			}
+		})
+	}
+}
@@ -81,7 +81,7 @@ func (a *App) SetupTokenSource() error {
 		return errors.New("Config is nil; call LoadConfig first")
 	}
 
-	flow, err := gcp.NewWebFlowHelper(a.Config.OAuthClientFile, []string{gmail.GmailReadonlyScope, drive.DriveScope})
+	flow, err := gcp.NewWebFlowHelper(a.Config.OAuthClientFile, []string{gmail.GmailReadonlyScope, gmail.GmailSendScope, gmail.GmailComposeScope, gmail.GmailModifyScope, gmail.GmailSettingsBasicScope, gmail.GmailSettingsSharingScope, drive.DriveScope})
 	if err != nil {
 		return err
 	}
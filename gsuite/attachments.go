@@ -0,0 +1,161 @@
+package gsuite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Attachment describes a file attached to a message.
+type Attachment struct {
+	MessageID string
+	PartID    string
+	Filename  string
+	MimeType  string
+	// Size is the size of the attachment in bytes.
+	Size int64
+	// AttachmentID is the id used to fetch the attachment. It is empty for small attachments whose data is
+	// returned inline with the message.
+	AttachmentID string `json:",omitempty"`
+}
+
+// ListAttachments returns the attachments on a message.
+func (i *Inbox) ListAttachments(ctx context.Context, messageID string) ([]*Attachment, error) {
+	msg, err := i.GetMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return attachments(msg), nil
+}
+
+// attachments returns the attachments in the MIME tree of the email.
+func attachments(msg *Email) []*Attachment {
+	results := make([]*Attachment, 0)
+	if msg.Payload == nil {
+		return results
+	}
+	msg.Payload.Walk(func(p *MessagePart, depth int) {
+		if !p.IsAttachment() {
+			return
+		}
+		results = append(results, &Attachment{
+			MessageID:    msg.ID,
+			PartID:       p.PartID,
+			Filename:     p.Filename,
+			MimeType:     p.MimeType,
+			Size:         p.Size,
+			AttachmentID: p.AttachmentID,
+		})
+	})
+	return results
+}
+
+// GetAttachment returns the contents of the attachment.
+func (i *Inbox) GetAttachment(ctx context.Context, a *Attachment) ([]byte, error) {
+	if a.AttachmentID != "" {
+		body, err := i.svc.Users.Messages.Attachments.Get(authUser, a.MessageID, a.AttachmentID).Context(ctx).Do()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error retrieving attachment %s of message %s", a.Filename, a.MessageID)
+		}
+		return decodeData(body.Data)
+	}
+
+	// Small attachments are returned inline so we need to find the part in the message.
+	fullMsg, err := i.svc.Users.Messages.Get(authUser, a.MessageID).Format("full").Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error retrieving message with id %s", a.MessageID)
+	}
+	part := findPart(fullMsg.Payload, a.PartID)
+	if part == nil || part.Body == nil {
+		return nil, errors.Errorf("Message %s doesn't have a part with id %s", a.MessageID, a.PartID)
+	}
+	return decodeData(part.Body.Data)
+}
+
+// SaveAttachments downloads all the attachments of a message into dir. It returns the paths of the files that were
+// written. Files are never overwritten; if a file with the same name already exists a suffix is added.
+func (i *Inbox) SaveAttachments(ctx context.Context, messageID string, dir string) ([]string, error) {
+	log := util.LoggerFromContext(ctx)
+	atts, err := i.ListAttachments(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create directory %s", dir)
+	}
+
+	paths := make([]string, 0, len(atts))
+	for _, a := range atts {
+		data, err := i.GetAttachment(ctx, a)
+		if err != nil {
+			return paths, err
+		}
+
+		path, err := uniquePath(dir, attachmentFilename(a))
+		if err != nil {
+			return paths, err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return paths, errors.Wrapf(err, "Failed to write attachment to %s", path)
+		}
+		log.Info("Saved attachment", "messageId", messageID, "file", path)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// findPart returns the part with the given id or nil if there isn't one.
+func findPart(part *gmail.MessagePart, partID string) *gmail.MessagePart {
+	if part == nil {
+		return nil
+	}
+	if part.PartId == partID {
+		return part
+	}
+	for _, child := range part.Parts {
+		if p := findPart(child, partID); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// attachmentFilename returns a name that is safe to use as a file name for the attachment. The filename comes from
+// the sender so we don't allow it to contain directories.
+func attachmentFilename(a *Attachment) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, a.Filename)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", a.MessageID, a.PartID)
+	}
+	return name
+}
+
+// uniquePath returns a path in dir for name that doesn't already exist by adding a numeric suffix if necessary.
+func uniquePath(dir string, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	path := filepath.Join(dir, name)
+	for n := 1; ; n++ {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to stat %s", path)
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, n, ext))
+	}
+}
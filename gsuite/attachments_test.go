@@ -0,0 +1,58 @@
+package gsuite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_AttachmentFilename(t *testing.T) {
+	type testCase struct {
+		name     string
+		a        *Attachment
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:     "basic",
+			a:        &Attachment{Filename: "invoice.pdf"},
+			expected: "invoice.pdf",
+		},
+		{
+			name:     "directories",
+			a:        &Attachment{Filename: "../../etc/passwd"},
+			expected: "_.._etc_passwd",
+		},
+		{
+			name:     "empty",
+			a:        &Attachment{MessageID: "m1", PartID: "1"},
+			expected: "m1-1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := attachmentFilename(c.a)
+			if actual != c.expected {
+				t.Errorf("Expected %q; got %q", c.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_UniquePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.csv"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	actual, err := uniquePath(dir, "report.csv")
+	if err != nil {
+		t.Fatalf("Error getting unique path: %v", err)
+	}
+	expected := filepath.Join(dir, "report (1).csv")
+	if actual != expected {
+		t.Errorf("Expected %q; got %q", expected, actual)
+	}
+}
@@ -0,0 +1,317 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// OutgoingMessage is a message to be composed and sent.
+type OutgoingMessage struct {
+	// From is optional; if it isn't set gmail uses the address of the authenticated user.
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	Subject string
+	// TextBody and HTMLBody are the plain text and HTML versions of the body. If both are set they are sent as a
+	// multipart/alternative so the recipient's client can choose which one to display.
+	TextBody    string
+	HTMLBody    string
+	Attachments []*OutgoingAttachment
+	// Headers are additional headers to add to the message.
+	Headers map[string]string
+	// ThreadID is the id of the gmail thread to add the message to. Gmail only adds the message to the thread if
+	// the Subject matches and the References or In-Reply-To headers refer to a message in the thread.
+	ThreadID string
+}
+
+// OutgoingAttachment is a file to attach to an OutgoingMessage.
+type OutgoingAttachment struct {
+	Filename string
+	// MimeType defaults to application/octet-stream if not set.
+	MimeType string
+	Data     []byte
+}
+
+// NewAttachmentFromFile reads the file at path into an attachment. The MIME type is inferred from the extension.
+func NewAttachmentFromFile(path string) (*OutgoingAttachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read attachment %s", path)
+	}
+	return &OutgoingAttachment{
+		Filename: filepath.Base(path),
+		MimeType: mime.TypeByExtension(filepath.Ext(path)),
+		Data:     data,
+	}, nil
+}
+
+// Send composes the message and sends it. It returns the sent message which contains the ids assigned by gmail.
+// If m has a From address it must be one of the user's send-as aliases.
+func (i *Inbox) Send(ctx context.Context, m *OutgoingMessage) (*gmail.Message, error) {
+	log := util.LoggerFromContext(ctx)
+	if err := i.resolveFrom(ctx, m); err != nil {
+		return nil, err
+	}
+	raw, err := m.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := i.svc.Users.Messages.Send(authUser, &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw), ThreadId: m.ThreadID}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send message")
+	}
+	log.Info("Sent message", "id", sent.Id, "threadId", sent.ThreadId, "subject", m.Subject)
+	return sent, nil
+}
+
+// Build returns the message formatted as an RFC 5322 message with a MIME body.
+func (m *OutgoingMessage) Build() ([]byte, error) {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return nil, errors.New("Message must have at least one recipient")
+	}
+	return m.build()
+}
+
+// build formats the message without requiring it to have recipients; drafts don't need them.
+func (m *OutgoingMessage) build() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if m.From != "" {
+		if err := writeAddressHeader(&buf, "From", []string{m.From}); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range []struct {
+		name  string
+		addrs []string
+	}{{"To", m.To}, {"Cc", m.Cc}, {"Bcc", m.Bcc}} {
+		if err := writeAddressHeader(&buf, h.name, h.addrs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject)); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z)); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(&buf, "MIME-Version", "1.0"); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		if isReservedHeader(name) {
+			return nil, errors.Errorf("Header %s is set from the message's fields and can't be set as an additional header", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeHeader(&buf, name, m.Headers[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if err := body.writeTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reservedHeaders are the headers build writes from the message's fields. RFC 5322 allows only one of each so
+// they can't be set as additional headers. In-Reply-To and References aren't reserved; replies set them.
+var reservedHeaders = map[string]bool{
+	"From":         true,
+	"To":           true,
+	"Cc":           true,
+	"Bcc":          true,
+	"Subject":      true,
+	"Date":         true,
+	"Mime-Version": true,
+}
+
+// isReservedHeader returns true if the header is written by build. The Content-* headers describe the body.
+func isReservedHeader(name string) bool {
+	canonical := textproto.CanonicalMIMEHeaderKey(name)
+	return reservedHeaders[canonical] || strings.HasPrefix(canonical, "Content-")
+}
+
+// body returns the MIME entity for the body of the message.
+func (m *OutgoingMessage) body() (*entity, error) {
+	var content *entity
+	switch {
+	case m.TextBody != "" && m.HTMLBody != "":
+		alt, err := newMultipartEntity("alternative", textEntity("text/plain", m.TextBody), textEntity("text/html", m.HTMLBody))
+		if err != nil {
+			return nil, err
+		}
+		content = alt
+	case m.HTMLBody != "":
+		content = textEntity("text/html", m.HTMLBody)
+	default:
+		content = textEntity("text/plain", m.TextBody)
+	}
+
+	if len(m.Attachments) == 0 {
+		return content, nil
+	}
+
+	parts := []*entity{content}
+	for _, a := range m.Attachments {
+		parts = append(parts, attachmentEntity(a))
+	}
+	return newMultipartEntity("mixed", parts...)
+}
+
+// entity is a MIME entity; i.e. the headers and body of a message or of one of its parts.
+type entity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// writeTo writes the entity's headers, the blank line that terminates them and the body.
+func (e *entity) writeTo(w io.Writer) error {
+	keys := make([]string, 0, len(e.header))
+	for k := range e.header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range e.header[k] {
+			if err := writeHeader(w, k, v); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+	_, err := w.Write(e.body)
+	return err
+}
+
+// textEntity returns a quoted-printable encoded UTF-8 text entity.
+func textEntity(contentType string, text string) *entity {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	// Writes to a bytes.Buffer can't fail.
+	_, _ = qp.Write([]byte(normalizeNewlines(text)))
+	_ = qp.Close()
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "UTF-8"}))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return &entity{header: header, body: buf.Bytes()}
+}
+
+// attachmentEntity returns a base64 encoded entity for the attachment.
+func attachmentEntity(a *OutgoingAttachment) *entity {
+	mimeType := a.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mimeType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	return &entity{header: header, body: wrapBase64(a.Data)}
+}
+
+// newMultipartEntity returns a multipart/<subtype> entity containing parts.
+func newMultipartEntity(subtype string, parts ...*entity) (*entity, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		pw, err := w.CreatePart(p.header)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create MIME part")
+		}
+		if _, err := pw.Write(p.body); err != nil {
+			return nil, errors.Wrapf(err, "Failed to write MIME part")
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to close multipart writer")
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": w.Boundary()}))
+	return &entity{header: header, body: buf.Bytes()}, nil
+}
+
+// writeAddressHeader validates the addresses and writes them as a header. Nothing is written if addrs is empty.
+func writeAddressHeader(w io.Writer, name string, addrs []string) error {
+	if len(addrs) == 0 {
+		return nil
+	}
+	formatted := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		parsed, err := mail.ParseAddressList(a)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid address %q in %s", a, name)
+		}
+		for _, p := range parsed {
+			formatted = append(formatted, p.String())
+		}
+	}
+	return writeHeader(w, name, strings.Join(formatted, ", "))
+}
+
+// writeHeader writes a single header. It rejects names and values that would allow header injection.
+func writeHeader(w io.Writer, name string, value string) error {
+	if name == "" || strings.ContainsAny(name, ":\r\n ") {
+		return errors.Errorf("Invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return errors.Errorf("Invalid value for header %s; values can't contain newlines", name)
+	}
+	_, err := fmt.Fprintf(w, "%s: %s\r\n", name, value)
+	return err
+}
+
+// wrapBase64 encodes data as base64 with lines of 76 characters as required by RFC 2045.
+func wrapBase64(data []byte) []byte {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > lineLength {
+		buf.WriteString(encoded[:lineLength])
+		buf.WriteString("\r\n")
+		encoded = encoded[lineLength:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// normalizeNewlines converts all line endings to CRLF as required by RFC 5322.
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
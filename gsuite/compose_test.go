@@ -0,0 +1,133 @@
+package gsuite
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func Test_BuildMessage(t *testing.T) {
+	m := &OutgoingMessage{
+		From:     "Jane Doe <jane@example.com>",
+		To:       []string{"bob@example.com", "\"Smith, Al\" <al@example.com>"},
+		Bcc:      []string{"hidden@example.com"},
+		Subject:  "Résumé attached",
+		TextBody: "Hi Bob,\nsee attached.",
+		HTMLBody: "<p>Hi Bob,</p><p>see attached.</p>",
+		Attachments: []*OutgoingAttachment{
+			{Filename: "report.csv", MimeType: "text/csv", Data: []byte("a,b\n1,2\n")},
+		},
+		Headers: map[string]string{"X-Gctl-Job": "nightly"},
+	}
+
+	raw, err := m.Build()
+	if err != nil {
+		t.Fatalf("Error building message: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Error parsing message: %v", err)
+	}
+
+	to, err := msg.Header.AddressList("To")
+	if err != nil {
+		t.Fatalf("Error parsing To: %v", err)
+	}
+	if len(to) != 2 || to[1].Name != "Smith, Al" {
+		t.Errorf("Unexpected To %v", to)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("Error decoding subject: %v", err)
+	}
+	if subject != m.Subject {
+		t.Errorf("Expected subject %q; got %q", m.Subject, subject)
+	}
+	if msg.Header.Get("X-Gctl-Job") != "nightly" {
+		t.Errorf("Custom header is missing")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Error parsing content type: %v", err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Expected multipart/mixed; got %s", mediaType)
+	}
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading part: %v", err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		types = append(types, mediaType)
+		if p.FileName() == "report.csv" {
+			// The multipart reader doesn't decode base64 so the body should still be encoded.
+			b, _ := io.ReadAll(p)
+			if !strings.Contains(string(b), "YSxiCjEsMgo=") {
+				t.Errorf("Unexpected attachment body %q", b)
+			}
+		}
+	}
+
+	expected := []string{"multipart/alternative", "text/csv"}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected parts %v; got %v", expected, types)
+	}
+}
+
+func Test_BuildMessageErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		m    *OutgoingMessage
+	}
+
+	cases := []testCase{
+		{
+			name: "no-recipients",
+			m:    &OutgoingMessage{Subject: "hello"},
+		},
+		{
+			name: "invalid-address",
+			m:    &OutgoingMessage{To: []string{"not an address"}},
+		},
+		{
+			name: "header-injection",
+			m: &OutgoingMessage{
+				To:      []string{"bob@example.com"},
+				Headers: map[string]string{"X-Test": "a\r\nBcc: evil@example.com"},
+			},
+		},
+	}
+
+	// Headers written from the message's fields can't be duplicated.
+	for _, name := range []string{"subject", "From", "BCC", "Content-Type", "MIME-Version"} {
+		cases = append(cases, testCase{
+			name: "reserved-" + name,
+			m: &OutgoingMessage{
+				To:      []string{"bob@example.com"},
+				Headers: map[string]string{name: "x"},
+			},
+		})
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := c.m.Build(); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Draft is a draft message.
+type Draft struct {
+	ID      string
+	Message *Email
+}
+
+// CreateDraft saves m as a new draft.
+func (i *Inbox) CreateDraft(ctx context.Context, m *OutgoingMessage) (*Draft, error) {
+	log := util.LoggerFromContext(ctx)
+	if err := i.resolveFrom(ctx, m); err != nil {
+		return nil, err
+	}
+	msg, err := draftMessage(m)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := i.svc.Users.Drafts.Create(authUser, &gmail.Draft{Message: msg}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create draft")
+	}
+	log.Info("Created draft", "id", d.Id, "subject", m.Subject)
+	return newDraft(d)
+}
+
+// GetDraftMessage returns the contents of the draft as an OutgoingMessage so that it can be changed and saved with
+// UpdateDraft. The draft's attachments are downloaded so they are kept when it is saved.
+func (i *Inbox) GetDraftMessage(ctx context.Context, draftID string) (*OutgoingMessage, error) {
+	d, err := i.GetDraft(ctx, draftID)
+	if err != nil {
+		return nil, err
+	}
+	m := &OutgoingMessage{Headers: map[string]string{}}
+	e := d.Message
+	if e == nil {
+		return m, nil
+	}
+
+	addresses := func(header string) []string {
+		var results []string
+		for _, a := range splitAddresses(header) {
+			results = append(results, a.String())
+		}
+		return results
+	}
+	if from := splitAddresses(e.From); len(from) > 0 {
+		// The display name is filled in from the send-as alias when the draft is saved.
+		m.From = from[0].Address
+	}
+	m.To = addresses(e.To)
+	m.Cc = addresses(e.Cc)
+	m.Bcc = addresses(e.Bcc)
+	m.Subject = e.Subject
+	m.TextBody = e.TextBody
+	m.HTMLBody = e.HTMLBody
+	m.ThreadID = e.ThreadID
+	if e.InReplyTo != "" {
+		m.Headers["In-Reply-To"] = e.InReplyTo
+	}
+	if e.References != "" {
+		m.Headers["References"] = e.References
+	}
+
+	for _, a := range attachments(e) {
+		data, err := i.GetAttachment(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		m.Attachments = append(m.Attachments, &OutgoingAttachment{
+			Filename: a.Filename,
+			MimeType: a.MimeType,
+			Data:     data,
+		})
+	}
+	return m, nil
+}
+
+// UpdateDraft replaces the contents of the draft with m.
+func (i *Inbox) UpdateDraft(ctx context.Context, draftID string, m *OutgoingMessage) (*Draft, error) {
+	if err := i.resolveFrom(ctx, m); err != nil {
+		return nil, err
+	}
+	msg, err := draftMessage(m)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := i.svc.Users.Drafts.Update(authUser, draftID, &gmail.Draft{Id: draftID, Message: msg}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to update draft %s", draftID)
+	}
+	return newDraft(d)
+}
+
+// GetDraft returns the draft including the full contents of its message.
+func (i *Inbox) GetDraft(ctx context.Context, draftID string) (*Draft, error) {
+	var d *gmail.Draft
+	err := retry(ctx, func() error {
+		var err error
+		d, err = i.svc.Users.Drafts.Get(authUser, draftID).Format("full").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error retrieving draft with id %s", draftID)
+	}
+	return newDraft(d)
+}
+
+// ListDrafts returns the drafts matching the query along with the token for the next page of results. The token is
+// empty if there are no more results. An empty query matches all drafts. If any draft can't be fetched it returns
+// the error and no drafts.
+func (i *Inbox) ListDrafts(ctx context.Context, query string, maxResults int64, pageToken string) ([]*Draft, string, error) {
+	listRequest := i.svc.Users.Drafts.List(authUser).Q(query).MaxResults(maxResults)
+	if pageToken != "" {
+		listRequest.PageToken(pageToken)
+	}
+	response, err := listRequest.Context(ctx).Do()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to list drafts")
+	}
+
+	// The list request only returns the ids so we need to fetch each draft.
+	drafts := make([]*Draft, len(response.Drafts))
+	errs := make([]error, len(response.Drafts))
+	parallel(len(response.Drafts), i.fetchWorkers, func(n int) {
+		drafts[n], errs[n] = i.GetDraft(ctx, response.Drafts[n].Id)
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return drafts, response.NextPageToken, nil
+}
+
+// SendDraft sends the draft. It returns the sent message.
+func (i *Inbox) SendDraft(ctx context.Context, draftID string) (*gmail.Message, error) {
+	log := util.LoggerFromContext(ctx)
+	sent, err := i.svc.Users.Drafts.Send(authUser, &gmail.Draft{Id: draftID}).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send draft %s", draftID)
+	}
+	log.Info("Sent draft", "draftId", draftID, "id", sent.Id, "threadId", sent.ThreadId)
+	return sent, nil
+}
+
+// draftMessage builds the gmail message for a draft.
+func draftMessage(m *OutgoingMessage) (*gmail.Message, error) {
+	raw, err := m.build()
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw), ThreadId: m.ThreadID}, nil
+}
+
+func newDraft(d *gmail.Draft) (*Draft, error) {
+	draft := &Draft{ID: d.Id}
+	if d.Message == nil {
+		return draft, nil
+	}
+	msg, err := newEmail(d.Message)
+	draft.Message = msg
+	return draft, err
+}
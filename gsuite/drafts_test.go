@@ -0,0 +1,112 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func Test_CreateDraftWithoutRecipients(t *testing.T) {
+	var raw string
+	inbox := newFakeInbox(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := &gmail.Draft{}
+		if err := json.NewDecoder(r.Body).Decode(d); err != nil {
+			t.Errorf("Error decoding draft: %v", err)
+		}
+		raw = d.Message.Raw
+		d.Id = "d1"
+		d.Message = &gmail.Message{Id: "m1", ThreadId: "t1"}
+		if err := json.NewEncoder(w).Encode(d); err != nil {
+			t.Errorf("Error encoding draft: %v", err)
+		}
+	}))
+
+	draft, err := inbox.CreateDraft(context.Background(), &OutgoingMessage{Subject: "Weekly report", TextBody: "TODO"})
+	if err != nil {
+		t.Fatalf("Error creating draft: %v", err)
+	}
+	if draft.ID != "d1" || draft.Message.ThreadID != "t1" {
+		t.Errorf("Unexpected draft %+v", draft)
+	}
+
+	decoded, err := decodeData(raw)
+	if err != nil {
+		t.Fatalf("Error decoding raw message: %v", err)
+	}
+	if !strings.Contains(string(decoded), "Subject: Weekly report\r\n") {
+		t.Errorf("Raw message is missing the subject:\n%s", decoded)
+	}
+}
+
+func Test_ListDrafts(t *testing.T) {
+	inbox := newFakeInbox(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/drafts"); id {
+		case "":
+			if r.URL.Query().Get("pageToken") != "p1" {
+				t.Errorf("Expected the page token to be passed; got %v", r.URL.Query())
+			}
+			resp = &gmail.ListDraftsResponse{Drafts: []*gmail.Draft{{Id: "d1"}}, NextPageToken: "p2"}
+		default:
+			resp = &gmail.Draft{Id: strings.TrimPrefix(id, "/"), Message: &gmail.Message{Id: "m1", Payload: &gmail.MessagePart{}}}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("Error encoding response: %v", err)
+		}
+	}))
+
+	drafts, pageToken, err := inbox.ListDrafts(context.Background(), "", 1, "p1")
+	if err != nil {
+		t.Fatalf("Error listing drafts: %v", err)
+	}
+	if len(drafts) != 1 || drafts[0].ID != "d1" {
+		t.Errorf("Unexpected drafts %+v", drafts)
+	}
+	if pageToken != "p2" {
+		t.Errorf("Expected the next page token; got %q", pageToken)
+	}
+}
+
+func Test_GetDraftMessage(t *testing.T) {
+	inbox := newFakeInbox(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := &gmail.Draft{
+			Id: "d1",
+			Message: &gmail.Message{
+				Id:       "m1",
+				ThreadId: "t1",
+				Payload: &gmail.MessagePart{
+					MimeType: "text/plain",
+					Headers: []*gmail.MessagePartHeader{
+						{Name: "From", Value: "Alice <alice@example.com>"},
+						{Name: "To", Value: "Bob <bob@example.com>, carol@example.com"},
+						{Name: "Subject", Value: "Re: Plans"},
+						{Name: "In-Reply-To", Value: "<a@example.com>"},
+						{Name: "References", Value: "<a@example.com>"},
+					},
+					Body: &gmail.MessagePartBody{Data: encodeData("Sounds good")},
+				},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(d); err != nil {
+			t.Errorf("Error encoding draft: %v", err)
+		}
+	}))
+
+	m, err := inbox.GetDraftMessage(context.Background(), "d1")
+	if err != nil {
+		t.Fatalf("Error getting draft: %v", err)
+	}
+	if m.From != "alice@example.com" || m.Subject != "Re: Plans" || m.TextBody != "Sounds good" || m.ThreadID != "t1" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if len(m.To) != 2 || m.To[0] != `"Bob" <bob@example.com>` || m.To[1] != "<carol@example.com>" {
+		t.Errorf("Unexpected recipients %q", m.To)
+	}
+	if m.Headers["In-Reply-To"] != "<a@example.com>" || m.Headers["References"] != "<a@example.com>" {
+		t.Errorf("Expected the threading headers to be kept; got %v", m.Headers)
+	}
+}
@@ -0,0 +1,396 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// ExportFormat is the format to export messages in.
+type ExportFormat string
+
+const (
+	// ExportMbox exports all the messages into a single file in mboxrd format.
+	ExportMbox ExportFormat = "mbox"
+	// ExportEML exports each message to its own .eml file in a directory.
+	ExportEML ExportFormat = "eml"
+
+	// exportBatchSize is the number of messages to fetch before writing them out.
+	exportBatchSize = 100
+)
+
+// RawMessage is a message in RFC 822 format exactly as gmail stores it.
+type RawMessage struct {
+	ID       string
+	ThreadID string
+	LabelIDs []string
+	// Date is the time gmail received the message.
+	Date time.Time
+	Data []byte
+}
+
+// ExportResult summarizes an export.
+type ExportResult struct {
+	// Exported is the number of messages written by this export.
+	Exported int
+	// Skipped is the number of matching messages that had already been exported.
+	Skipped int
+	// Manifest is the path of the manifest listing every exported message.
+	Manifest string
+}
+
+// manifestEntry records an exported message in the manifest.
+type manifestEntry struct {
+	ID       string    `json:"id"`
+	ThreadID string    `json:"threadId"`
+	Date     time.Time `json:"date"`
+	// File is the path of the .eml file relative to the export directory.
+	File string `json:"file,omitempty"`
+	// Offset and Length locate the message in an mbox file.
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
+}
+
+// GetRawMessage fetches the message in RFC 822 format.
+func (i *Inbox) GetRawMessage(ctx context.Context, messageID string) (*RawMessage, error) {
+	var msg *gmail.Message
+	err := retry(ctx, func() error {
+		var err error
+		msg, err = i.svc.Users.Messages.Get(authUser, messageID).Format("raw").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error retrieving message with id %s", messageID)
+	}
+
+	data, err := decodeData(msg.Raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode raw message %s", messageID)
+	}
+	return &RawMessage{
+		ID:       msg.Id,
+		ThreadID: msg.ThreadId,
+		LabelIDs: msg.LabelIds,
+		Date:     parseEpochMillis(msg.InternalDate),
+		Data:     data,
+	}, nil
+}
+
+// fetchRaw fetches the raw messages concurrently. The results are in the same order as ids. If any message can't
+// be fetched it returns the messages preceding it along with the error.
+func (i *Inbox) fetchRaw(ctx context.Context, ids []string) ([]*RawMessage, error) {
+	results := make([]*RawMessage, len(ids))
+	errs := make([]error, len(ids))
+	parallel(len(ids), i.fetchWorkers, func(n int) {
+		results[n], errs[n] = i.GetRawMessage(ctx, ids[n])
+	})
+
+	for n, err := range errs {
+		if err != nil {
+			return results[:n], err
+		}
+	}
+	return results, nil
+}
+
+// Export writes the messages matching query to out. For ExportMbox out is the mbox file and for ExportEML it is a
+// directory. A manifest of the exported messages is kept next to the export; messages already in it are skipped so
+// an export can be rerun to pick up new messages or resume after a failure without creating duplicates.
+func (i *Inbox) Export(ctx context.Context, query string, format ExportFormat, out string) (*ExportResult, error) {
+	log := util.LoggerFromContext(ctx)
+
+	var w exportWriter
+	switch format {
+	case ExportMbox:
+		w = &mboxExportWriter{path: out}
+	case ExportEML:
+		w = &emlExportWriter{dir: out}
+	default:
+		return nil, errors.Errorf("Unsupported export format %q; must be %s or %s", format, ExportMbox, ExportEML)
+	}
+
+	manifest, err := openManifest(w.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+	if err := w.open(manifest.entries); err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	ids, _, err := i.listMessageIDs(ctx, query, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+	// Gmail returns the newest messages first but archives are conventionally oldest first.
+	slices.Reverse(ids)
+
+	result := &ExportResult{Manifest: manifest.path}
+	toExport := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if manifest.has(id) {
+			result.Skipped++
+			continue
+		}
+		toExport = append(toExport, id)
+	}
+	log.Info("Exporting messages", "query", query, "matched", len(ids), "alreadyExported", result.Skipped)
+
+	for start := 0; start < len(toExport); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(toExport))
+		msgs, fetchErr := i.fetchRaw(ctx, toExport[start:end])
+
+		// Write the messages that were fetched even if some failed so a rerun resumes after them.
+		for _, msg := range msgs {
+			entry, err := w.write(msg)
+			if err != nil {
+				return result, err
+			}
+			if err := manifest.add(entry); err != nil {
+				return result, err
+			}
+			result.Exported++
+		}
+		if fetchErr != nil {
+			return result, fetchErr
+		}
+	}
+	return result, nil
+}
+
+// exportWriter writes messages in a particular export format.
+type exportWriter interface {
+	manifestPath() string
+	// open prepares the writer given the messages that were already exported.
+	open(entries []*manifestEntry) error
+	write(msg *RawMessage) (*manifestEntry, error)
+	Close() error
+}
+
+// emlExportWriter writes each message to <id>.eml in a directory.
+type emlExportWriter struct {
+	dir string
+}
+
+func (e *emlExportWriter) manifestPath() string {
+	return filepath.Join(e.dir, "manifest.jsonl")
+}
+
+func (e *emlExportWriter) open(entries []*manifestEntry) error {
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory %s", e.dir)
+	}
+	return nil
+}
+
+func (e *emlExportWriter) write(msg *RawMessage) (*manifestEntry, error) {
+	name := msg.ID + ".eml"
+	if err := writeFileAtomic(filepath.Join(e.dir, name), msg.Data); err != nil {
+		return nil, err
+	}
+	return &manifestEntry{ID: msg.ID, ThreadID: msg.ThreadID, Date: msg.Date, File: name}, nil
+}
+
+func (e *emlExportWriter) Close() error {
+	return nil
+}
+
+// mboxExportWriter appends messages to an mbox file.
+type mboxExportWriter struct {
+	path   string
+	f      *os.File
+	offset int64
+}
+
+func (m *mboxExportWriter) manifestPath() string {
+	return m.path + ".manifest.jsonl"
+}
+
+func (m *mboxExportWriter) open(entries []*manifestEntry) error {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory for %s", m.path)
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open mbox %s", m.path)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "Failed to stat mbox %s", m.path)
+	}
+
+	for _, e := range entries {
+		m.offset = max(m.offset, e.Offset+e.Length)
+	}
+	switch {
+	case len(entries) == 0 && info.Size() > 0:
+		// Without a manifest we don't know what is in the file so we refuse rather than overwrite or duplicate it.
+		f.Close()
+		return errors.Errorf("mbox %s already exists but has no manifest %s; export to a new file", m.path, m.manifestPath())
+	case info.Size() < m.offset:
+		f.Close()
+		return errors.Errorf("mbox %s is shorter than the messages recorded in its manifest %s; it was modified after it was exported", m.path, m.manifestPath())
+	case info.Size() > m.offset:
+		// If a previous export was interrupted after writing a message but before recording it in the manifest the
+		// message would be duplicated. So we truncate the mbox to the end of the last recorded message.
+		if err := f.Truncate(m.offset); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "Failed to truncate mbox %s", m.path)
+		}
+	}
+	if _, err := f.Seek(m.offset, 0); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "Failed to seek in mbox %s", m.path)
+	}
+	m.f = f
+	return nil
+}
+
+func (m *mboxExportWriter) write(msg *RawMessage) (*manifestEntry, error) {
+	n, err := writeMboxMessage(m.f, msg.Date, msg.Data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to write message %s to mbox %s", msg.ID, m.path)
+	}
+	entry := &manifestEntry{ID: msg.ID, ThreadID: msg.ThreadID, Date: msg.Date, Offset: m.offset, Length: n}
+	m.offset += n
+	return entry, nil
+}
+
+func (m *mboxExportWriter) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	return m.f.Close()
+}
+
+// manifest is the JSON lines file recording the exported messages.
+type manifest struct {
+	*jsonlFile
+	entries []*manifestEntry
+	ids     map[string]bool
+}
+
+// openManifest reads the manifest at path if it exists and opens it for appending.
+func openManifest(path string) (*manifest, error) {
+	m := &manifest{ids: map[string]bool{}}
+	f, err := openJSONL(path, func(line []byte) error {
+		entry := &manifestEntry{}
+		if err := decodeJSONLRecord(line, entry); err != nil {
+			return err
+		}
+		if entry.ID == "" {
+			return errors.New("Entry is missing the message id")
+		}
+		m.entries = append(m.entries, entry)
+		m.ids[entry.ID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.jsonlFile = f
+	return m, nil
+}
+
+func (m *manifest) has(id string) bool {
+	return m.ids[id]
+}
+
+func (m *manifest) add(entry *manifestEntry) error {
+	if err := m.append(entry); err != nil {
+		return err
+	}
+	m.entries = append(m.entries, entry)
+	m.ids[entry.ID] = true
+	return nil
+}
+
+// jsonlFile is an append only JSON lines file; e.g. an export manifest, import checkpoint or mail merge log.
+type jsonlFile struct {
+	path string
+	f    *os.File
+}
+
+// openJSONL calls decode with each line of the file at path if it exists and opens it for appending.
+func openJSONL(path string, decode func(line []byte) error) (*jsonlFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create directory for %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Failed to read %s", path)
+	}
+
+	// If we were interrupted while writing a record the last line won't end in a newline. Drop it so the next
+	// record isn't appended to it; the message it recorded will be processed again.
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	lines := bytes.Split(data[:complete], []byte("\n"))
+	for n, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		if err := decode(line); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse line %d of %s", n+1, path)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s", path)
+	}
+	if complete < len(data) {
+		if err := f.Truncate(int64(complete)); err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "Failed to truncate %s", path)
+		}
+	}
+	return &jsonlFile{path: path, f: f}, nil
+}
+
+// decodeJSONLRecord decodes a line of a JSON lines file into record. Unknown fields are rejected so that a file
+// holding a different kind of record, e.g. an export manifest passed as an import checkpoint, is an error.
+func decodeJSONLRecord(line []byte, record interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.DisallowUnknownFields()
+	return d.Decode(record)
+}
+
+// append writes record as a line of the file.
+func (j *jsonlFile) append(record interface{}) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal record")
+	}
+	if _, err := fmt.Fprintf(j.f, "%s\n", b); err != nil {
+		return errors.Wrapf(err, "Failed to write to %s", j.path)
+	}
+	return nil
+}
+
+func (j *jsonlFile) Close() error {
+	return j.f.Close()
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path so path is never partially written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.Wrapf(err, "Failed to write %s", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "Failed to rename %s to %s", tmp, path)
+	}
+	return nil
+}
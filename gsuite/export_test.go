@@ -0,0 +1,133 @@
+package gsuite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ExportMbox(t *testing.T) {
+	fake := &fakeMessages{t: t, count: 3}
+	inbox := newFakeInbox(t, fake)
+	ctx := context.Background()
+	out := filepath.Join(t.TempDir(), "archive.mbox")
+
+	result, err := inbox.Export(ctx, "", ExportMbox, out)
+	if err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+	if result.Exported != 3 || result.Skipped != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	first, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Error reading mbox: %v", err)
+	}
+	if strings.Count(string(first), "\nFrom MAILER-DAEMON ") != 2 || !strings.HasPrefix(string(first), "From MAILER-DAEMON ") {
+		t.Errorf("Expected 3 messages in the mbox:\n%s", first)
+	}
+	if !strings.Contains(string(first), "\r\n>From the body of m2\r\n") {
+		t.Errorf("Expected From lines in the body to be quoted:\n%s", first)
+	}
+	// Messages should be oldest first which is the reverse of the order gmail lists them in.
+	if strings.Index(string(first), "m2") > strings.Index(string(first), "m0") {
+		t.Errorf("Expected m2 before m0")
+	}
+
+	// Rerunning the export with a new message should only append the new message.
+	fake.count = 4
+	result, err = inbox.Export(ctx, "", ExportMbox, out)
+	if err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+	if result.Exported != 1 || result.Skipped != 3 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	second, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Error reading mbox: %v", err)
+	}
+	if !strings.HasPrefix(string(second), string(first)) || strings.Count(string(second), "Subject of m3") != 1 {
+		t.Errorf("Expected the new message to be appended:\n%s", second)
+	}
+}
+
+func Test_ExportEML(t *testing.T) {
+	inbox := newFakeInbox(t, &fakeMessages{t: t, count: 2})
+	out := t.TempDir()
+
+	if _, err := inbox.Export(context.Background(), "", ExportEML, out); err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+
+	actual, err := os.ReadFile(filepath.Join(out, "m1.eml"))
+	if err != nil {
+		t.Fatalf("Error reading eml: %v", err)
+	}
+	if string(actual) != fakeRawMessage("m1") {
+		t.Errorf("Expected the exported message to match the original byte for byte; got\n%q", actual)
+	}
+
+	manifest, err := openManifest(filepath.Join(out, "manifest.jsonl"))
+	if err != nil {
+		t.Fatalf("Error opening manifest: %v", err)
+	}
+	defer manifest.Close()
+	if !manifest.has("m0") || !manifest.has("m1") {
+		t.Errorf("Expected the manifest to list m0 and m1; got %+v", manifest.entries)
+	}
+}
+
+func Test_OpenManifestPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":"m0"}`+"\n"+`{"id":"m1","thr`), 0o644); err != nil {
+		t.Fatalf("Error writing manifest: %v", err)
+	}
+
+	m, err := openManifest(path)
+	if err != nil {
+		t.Fatalf("Error opening manifest: %v", err)
+	}
+	if !m.has("m0") || m.has("m1") {
+		t.Errorf("Expected only m0 in the manifest; got %+v", m.entries)
+	}
+	if err := m.add(&manifestEntry{ID: "m2", Date: time.Unix(0, 0)}); err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Error closing manifest: %v", err)
+	}
+
+	reopened, err := openManifest(path)
+	if err != nil {
+		t.Fatalf("Error reopening manifest: %v", err)
+	}
+	defer reopened.Close()
+	if len(reopened.entries) != 2 || !reopened.has("m2") {
+		t.Errorf("Unexpected entries %+v", reopened.entries)
+	}
+}
+
+func Test_ExportMboxExistingFile(t *testing.T) {
+	inbox := newFakeInbox(t, &fakeMessages{t: t, count: 1})
+	out := filepath.Join(t.TempDir(), "mine.mbox")
+	original := "From someone Mon Jan  1 00:00:00 2024\nSubject: mine\n\nkeep me\n"
+	if err := os.WriteFile(out, []byte(original), 0o644); err != nil {
+		t.Fatalf("Error writing mbox: %v", err)
+	}
+
+	if _, err := inbox.Export(context.Background(), "", ExportMbox, out); err == nil {
+		t.Errorf("Expected exporting to an mbox without a manifest to fail")
+	}
+	actual, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Error reading mbox: %v", err)
+	}
+	if string(actual) != original {
+		t.Errorf("Expected the existing mbox to be unchanged; got\n%s", actual)
+	}
+}
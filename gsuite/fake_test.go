@@ -0,0 +1,109 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// newFakeInbox returns an Inbox whose requests are served by handler.
+func newFakeInbox(t testing.TB, handler http.Handler) *Inbox {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	svc, err := gmail.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("Error creating gmail service: %v", err)
+	}
+	return &Inbox{svc: svc}
+}
+
+// encodeData encodes data the way gmail encodes message bodies.
+func encodeData(data string) string {
+	return base64.URLEncoding.EncodeToString([]byte(data))
+}
+
+// fakeMessages is a fake implementation of the messages API serving count messages with ids m0, m1, ...
+type fakeMessages struct {
+	t     testing.TB
+	count int
+	// pageSize is the maximum number of messages per page. If not set the maxResults parameter is used.
+	pageSize int
+	// latency is added to every request to simulate the round trip to gmail.
+	latency time.Duration
+	// fail are the ids of messages for which fetching fails.
+	fail map[string]bool
+
+	mu       sync.Mutex
+	modified []*gmail.BatchModifyMessagesRequest
+}
+
+func (f *fakeMessages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.latency)
+	const prefix = "/gmail/v1/users/me/messages"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	var resp interface{}
+	switch {
+	case path == "":
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		if f.pageSize > 0 && (size == 0 || f.pageSize < size) {
+			size = f.pageSize
+		}
+		list := &gmail.ListMessagesResponse{}
+		for n := start; n < f.count && n < start+size; n++ {
+			list.Messages = append(list.Messages, &gmail.Message{Id: fmt.Sprintf("m%d", n)})
+		}
+		if start+size < f.count {
+			list.NextPageToken = strconv.Itoa(start + size)
+		}
+		resp = list
+	case path == "/batchModify":
+		req := &gmail.BatchModifyMessagesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			f.t.Errorf("Error decoding request: %v", err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.modified = append(f.modified, req)
+		return
+	default:
+		id := strings.TrimPrefix(path, "/")
+		if f.fail[id] {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		msg := &gmail.Message{
+			Id:       id,
+			ThreadId: "t" + id,
+			Payload: &gmail.MessagePart{
+				Headers: []*gmail.MessagePartHeader{{Name: "Subject", Value: "Subject of " + id}},
+			},
+		}
+		if r.URL.Query().Get("format") == "raw" {
+			msg.Payload = nil
+			msg.Raw = encodeData(fakeRawMessage(id))
+		}
+		resp = msg
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+// fakeRawMessage returns the RFC 822 message served by fakeMessages for id.
+func fakeRawMessage(id string) string {
+	return fmt.Sprintf("From: bob@example.com\r\nSubject: Subject of %s\r\n\r\nFrom the body of %s\r\n", id, id)
+}
@@ -0,0 +1,299 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	filtersAPIVersion = "gctl.jlewi.github.io/v1alpha1"
+	filtersKind       = "GmailFilters"
+)
+
+// FilterList is the YAML document listing a mailbox's filters.
+type FilterList struct {
+	APIVersion string    `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string    `json:"kind" yaml:"kind"`
+	Filters    []*Filter `json:"filters" yaml:"filters"`
+}
+
+// Filter is a gmail filter. Labels are referred to by name so that the filters can be stored and reviewed as
+// code; system labels are referred to by id (e.g. INBOX, UNREAD).
+type Filter struct {
+	// ID is set for filters that exist in gmail. It isn't written to YAML because gmail filters can't be updated;
+	// a changed filter is a new filter.
+	ID       string         `json:"-" yaml:"-"`
+	Criteria FilterCriteria `json:"criteria" yaml:"criteria"`
+	Action   FilterAction   `json:"action" yaml:"action"`
+}
+
+// FilterCriteria selects the messages a filter applies to.
+type FilterCriteria struct {
+	From          string `json:"from,omitempty" yaml:"from,omitempty"`
+	To            string `json:"to,omitempty" yaml:"to,omitempty"`
+	Subject       string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Query         string `json:"query,omitempty" yaml:"query,omitempty"`
+	NegatedQuery  string `json:"negatedQuery,omitempty" yaml:"negatedQuery,omitempty"`
+	HasAttachment bool   `json:"hasAttachment,omitempty" yaml:"hasAttachment,omitempty"`
+	ExcludeChats  bool   `json:"excludeChats,omitempty" yaml:"excludeChats,omitempty"`
+	// Size is in bytes and SizeComparison is "larger" or "smaller".
+	Size           int64  `json:"size,omitempty" yaml:"size,omitempty"`
+	SizeComparison string `json:"sizeComparison,omitempty" yaml:"sizeComparison,omitempty"`
+}
+
+// FilterAction is what a filter does to matching messages.
+type FilterAction struct {
+	AddLabels    []string `json:"addLabels,omitempty" yaml:"addLabels,omitempty"`
+	RemoveLabels []string `json:"removeLabels,omitempty" yaml:"removeLabels,omitempty"`
+	// Forward is the address to forward messages to. It must be a verified forwarding address.
+	Forward string `json:"forward,omitempty" yaml:"forward,omitempty"`
+}
+
+// key returns a string identifying the filter's criteria and action. Label names are compared case insensitively
+// and regardless of order like gmail does.
+func (f *Filter) key() (string, error) {
+	normalize := func(labels []string) []string {
+		n := make([]string, 0, len(labels))
+		for _, l := range labels {
+			n = append(n, strings.ToLower(l))
+		}
+		sort.Strings(n)
+		return n
+	}
+	c := *f
+	c.ID = ""
+	c.Action.AddLabels = normalize(f.Action.AddLabels)
+	c.Action.RemoveLabels = normalize(f.Action.RemoveLabels)
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to marshal filter")
+	}
+	return string(b), nil
+}
+
+// FilterPlan is the changes needed to make gmail's filters match the desired filters.
+type FilterPlan struct {
+	Create []*Filter
+	Delete []*Filter
+	// Unchanged is the number of filters that already exist.
+	Unchanged int
+	// MissingLabels are labels referenced by filters to be created that don't exist yet.
+	MissingLabels []string
+}
+
+// HasChanges returns true if applying the plan would change anything.
+func (p *FilterPlan) HasChanges() bool {
+	return len(p.Create)+len(p.Delete)+len(p.MissingLabels) > 0
+}
+
+// Diff returns a human readable description of the plan. Filters that will be created are prefixed with "+" and
+// filters that will be deleted with "-".
+func (p *FilterPlan) Diff() (string, error) {
+	var sb strings.Builder
+	for _, l := range p.MissingLabels {
+		sb.WriteString("+ label: " + l + "\n")
+	}
+	write := func(prefix string, f *Filter) error {
+		var buf bytes.Buffer
+		e := yaml.NewEncoder(&buf)
+		e.SetIndent(2)
+		if err := e.Encode([]*Filter{f}); err != nil {
+			return errors.Wrapf(err, "Failed to marshal filter")
+		}
+		for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+			sb.WriteString(prefix + " " + line + "\n")
+		}
+		return nil
+	}
+	for _, f := range p.Delete {
+		if err := write("-", f); err != nil {
+			return "", err
+		}
+	}
+	for _, f := range p.Create {
+		if err := write("+", f); err != nil {
+			return "", err
+		}
+	}
+	if !p.HasChanges() {
+		sb.WriteString("No changes\n")
+	}
+	return sb.String(), nil
+}
+
+// ReadFilters parses a YAML FilterList.
+func ReadFilters(r io.Reader) ([]*Filter, error) {
+	list := &FilterList{}
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	if err := d.Decode(list); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse filters")
+	}
+	if list.Kind != "" && list.Kind != filtersKind {
+		return nil, errors.Errorf("Expected kind %s; got %s", filtersKind, list.Kind)
+	}
+	return list.Filters, nil
+}
+
+// WriteFilters writes the filters as a YAML FilterList.
+func WriteFilters(w io.Writer, filters []*Filter) error {
+	list := &FilterList{APIVersion: filtersAPIVersion, Kind: filtersKind, Filters: filters}
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(list); err != nil {
+		return errors.Wrapf(err, "Failed to write filters")
+	}
+	return e.Close()
+}
+
+// ListFilters returns the mailbox's filters with label ids resolved to names.
+func (i *Inbox) ListFilters(ctx context.Context) ([]*Filter, error) {
+	resp, err := i.svc.Users.Settings.Filters.List(authUser).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list filters")
+	}
+	filters := make([]*Filter, 0, len(resp.Filter))
+	for _, gf := range resp.Filter {
+		f := &Filter{ID: gf.Id}
+		if c := gf.Criteria; c != nil {
+			f.Criteria = FilterCriteria{
+				From:           c.From,
+				To:             c.To,
+				Subject:        c.Subject,
+				Query:          c.Query,
+				NegatedQuery:   c.NegatedQuery,
+				HasAttachment:  c.HasAttachment,
+				ExcludeChats:   c.ExcludeChats,
+				Size:           c.Size,
+				SizeComparison: c.SizeComparison,
+			}
+		}
+		if a := gf.Action; a != nil {
+			f.Action = FilterAction{
+				AddLabels:    i.labelNames(ctx, a.AddLabelIds),
+				RemoveLabels: i.labelNames(ctx, a.RemoveLabelIds),
+				Forward:      a.Forward,
+			}
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// PlanFilters compares the desired filters with the mailbox's filters and returns the changes needed to make
+// them match. Filters in gmail that aren't desired are deleted.
+func (i *Inbox) PlanFilters(ctx context.Context, desired []*Filter) (*FilterPlan, error) {
+	existing, err := i.ListFilters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &FilterPlan{}
+	existingKeys := make(map[string]bool, len(existing))
+	keys := make(map[*Filter]string, len(existing))
+	for _, f := range existing {
+		k, err := f.key()
+		if err != nil {
+			return nil, err
+		}
+		keys[f] = k
+		existingKeys[k] = true
+	}
+	desiredKeys := make(map[string]bool, len(desired))
+	missing := map[string]bool{}
+	for _, f := range desired {
+		k, err := f.key()
+		if err != nil {
+			return nil, err
+		}
+		if desiredKeys[k] {
+			continue
+		}
+		desiredKeys[k] = true
+		if existingKeys[k] {
+			plan.Unchanged++
+			continue
+		}
+		plan.Create = append(plan.Create, f)
+
+		for _, name := range append(append([]string{}, f.Action.AddLabels...), f.Action.RemoveLabels...) {
+			l, err := i.GetLabel(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if l == nil && !missing[strings.ToLower(name)] {
+				missing[strings.ToLower(name)] = true
+				plan.MissingLabels = append(plan.MissingLabels, name)
+			}
+		}
+	}
+	for _, f := range existing {
+		if !desiredKeys[keys[f]] {
+			plan.Delete = append(plan.Delete, f)
+		}
+	}
+	return plan, nil
+}
+
+// ApplyFilters applies the plan. Missing labels and new filters are created before old filters are deleted so that
+// mail keeps being filtered while the filters are changed.
+func (i *Inbox) ApplyFilters(ctx context.Context, plan *FilterPlan) error {
+	log := util.LoggerFromContext(ctx)
+	for _, name := range plan.MissingLabels {
+		if _, err := i.CreateLabel(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range plan.Create {
+		add, err := i.labelIDs(ctx, f.Action.AddLabels)
+		if err != nil {
+			return err
+		}
+		remove, err := i.labelIDs(ctx, f.Action.RemoveLabels)
+		if err != nil {
+			return err
+		}
+		c := f.Criteria
+		gf := &gmail.Filter{
+			Criteria: &gmail.FilterCriteria{
+				From:           c.From,
+				To:             c.To,
+				Subject:        c.Subject,
+				Query:          c.Query,
+				NegatedQuery:   c.NegatedQuery,
+				HasAttachment:  c.HasAttachment,
+				ExcludeChats:   c.ExcludeChats,
+				Size:           c.Size,
+				SizeComparison: c.SizeComparison,
+			},
+			Action: &gmail.FilterAction{
+				AddLabelIds:    add,
+				RemoveLabelIds: remove,
+				Forward:        f.Action.Forward,
+			},
+		}
+		created, err := i.svc.Users.Settings.Filters.Create(authUser, gf).Context(ctx).Do()
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create filter with criteria %+v", f.Criteria)
+		}
+		log.Info("Created filter", "id", created.Id)
+	}
+
+	for _, f := range plan.Delete {
+		if err := i.svc.Users.Settings.Filters.Delete(authUser, f.ID).Context(ctx).Do(); err != nil {
+			return errors.Wrapf(err, "Failed to delete filter %s", f.ID)
+		}
+		log.Info("Deleted filter", "id", f.ID)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeFilters is a fake implementation of the filters API. Label requests are served by labels.
+type fakeFilters struct {
+	t       *testing.T
+	labels  *fakeLabels
+	filters map[string]*gmail.Filter
+	nextID  int
+}
+
+func (f *fakeFilters) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/settings/filters"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		f.labels.ServeHTTP(w, r)
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	var resp interface{}
+	switch r.Method {
+	case http.MethodGet:
+		list := &gmail.ListFiltersResponse{}
+		for n := 0; n < f.nextID; n++ {
+			if filter, ok := f.filters[fmt.Sprintf("f%d", n)]; ok {
+				list.Filter = append(list.Filter, filter)
+			}
+		}
+		resp = list
+	case http.MethodPost:
+		filter := &gmail.Filter{}
+		if err := json.NewDecoder(r.Body).Decode(filter); err != nil {
+			f.t.Errorf("Error decoding filter: %v", err)
+		}
+		filter.Id = fmt.Sprintf("f%d", f.nextID)
+		f.nextID++
+		f.filters[filter.Id] = filter
+		resp = filter
+	case http.MethodDelete:
+		delete(f.filters, id)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+const testFilters = `apiVersion: gctl.jlewi.github.io/v1alpha1
+kind: GmailFilters
+filters:
+  - criteria:
+      from: billing@example.com
+    action:
+      addLabels:
+        - receipts
+      removeLabels:
+        - INBOX
+  - criteria:
+      query: list:announce.example.com
+    action:
+      addLabels:
+        - Lists/Announce
+`
+
+func Test_FiltersPlanAndApply(t *testing.T) {
+	f := &fakeFilters{
+		t: t,
+		labels: &fakeLabels{t: t, labels: map[string]*gmail.Label{
+			"INBOX":   {Id: "INBOX", Name: "INBOX", Type: "system"},
+			"Label_a": {Id: "Label_a", Name: "Receipts", Type: "user"},
+		}},
+		filters: map[string]*gmail.Filter{
+			"f0": {
+				Id:       "f0",
+				Criteria: &gmail.FilterCriteria{From: "billing@example.com"},
+				Action:   &gmail.FilterAction{AddLabelIds: []string{"Label_a"}, RemoveLabelIds: []string{"INBOX"}},
+			},
+			"f1": {
+				Id:       "f1",
+				Criteria: &gmail.FilterCriteria{Subject: "old"},
+				Action:   &gmail.FilterAction{RemoveLabelIds: []string{"INBOX"}},
+			},
+		},
+		nextID: 2,
+	}
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+
+	desired, err := ReadFilters(strings.NewReader(testFilters))
+	if err != nil {
+		t.Fatalf("Error reading filters: %v", err)
+	}
+	plan, err := inbox.PlanFilters(ctx, desired)
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if plan.Unchanged != 1 || len(plan.Create) != 1 || len(plan.Delete) != 1 || plan.Delete[0].ID != "f1" {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+	if len(plan.MissingLabels) != 1 || plan.MissingLabels[0] != "Lists/Announce" {
+		t.Errorf("Expected Lists/Announce to be missing; got %v", plan.MissingLabels)
+	}
+
+	diff, err := plan.Diff()
+	if err != nil {
+		t.Fatalf("Error diffing: %v", err)
+	}
+	for _, line := range []string{"+ label: Lists/Announce", "-     subject: old", "+     query: list:announce.example.com"} {
+		if !strings.Contains(diff, line+"\n") {
+			t.Errorf("Expected the diff to contain %q; got\n%s", line, diff)
+		}
+	}
+
+	if err := inbox.ApplyFilters(ctx, plan); err != nil {
+		t.Fatalf("Error applying: %v", err)
+	}
+	if _, ok := f.filters["f1"]; ok {
+		t.Errorf("Expected f1 to be deleted")
+	}
+	created := f.filters["f2"]
+	if created == nil || created.Criteria.Query != "list:announce.example.com" {
+		t.Fatalf("Expected the new filter to be created; got %+v", f.filters)
+	}
+	label := f.labels.labels[created.Action.AddLabelIds[0]]
+	if label == nil || label.Name != "Lists/Announce" {
+		t.Errorf("Expected the filter to use the created label; got %+v", label)
+	}
+
+	// Once applied there is nothing left to do and exporting round trips.
+	plan, err = inbox.PlanFilters(ctx, desired)
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if diff, err := plan.Diff(); err != nil || plan.HasChanges() || diff != "No changes\n" {
+		t.Errorf("Expected no changes; got\n%s", diff)
+	}
+
+	filters, err := inbox.ListFilters(ctx)
+	if err != nil {
+		t.Fatalf("Error listing filters: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteFilters(&buf, filters); err != nil {
+		t.Fatalf("Error writing filters: %v", err)
+	}
+	exported, err := ReadFilters(&buf)
+	if err != nil {
+		t.Fatalf("Error reading exported filters: %v", err)
+	}
+	plan, err = inbox.PlanFilters(ctx, exported)
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("Expected the exported filters to match; got %+v", plan)
+	}
+}
+
+func Test_ReadFiltersUnknownField(t *testing.T) {
+	_, err := ReadFilters(strings.NewReader("filters:\n  - critera:\n      from: a@example.com\n"))
+	if err == nil {
+		t.Errorf("Expected misspelled fields to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package gsuite
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrHistoryExpired is returned by ListHistory when the starting history id is too old. Gmail only keeps history
+// for about a week so callers need to fall back to a full sync.
+var ErrHistoryExpired = errors.New("gmail history has expired; a full sync is required")
+
+// HistoryChanges are the messages that changed since a point in the mailbox's history.
+// A message is only in one of Added, Deleted and LabelsChanged; if a message was added and then deleted it is only
+// in Deleted.
+type HistoryChanges struct {
+	// Added are the ids of new messages in the order they were added.
+	Added []string
+	// Deleted are the ids of messages that were permanently deleted.
+	Deleted []string
+	// LabelsChanged are the ids of existing messages whose labels changed.
+	LabelsChanged []string
+	// HistoryID is the id to start from to get the next changes.
+	HistoryID uint64
+}
+
+// HistoryID returns the current history id of the mailbox.
+func (i *Inbox) HistoryID(ctx context.Context) (uint64, error) {
+	profile, err := i.svc.Users.GetProfile(authUser).Context(ctx).Do()
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to get the gmail profile")
+	}
+	return profile.HistoryId, nil
+}
+
+// ListHistory returns the messages that changed since startHistoryID.
+// It returns ErrHistoryExpired if startHistoryID is too old.
+func (i *Inbox) ListHistory(ctx context.Context, startHistoryID uint64) (*HistoryChanges, error) {
+	const (
+		added   = "added"
+		deleted = "deleted"
+		labels  = "labels"
+	)
+	// kinds records the latest kind of change for each message and order records the order messages were first seen.
+	kinds := map[string]string{}
+	order := make([]string, 0)
+	record := func(msg *gmail.Message, kind string) {
+		if msg == nil {
+			return
+		}
+		prev, ok := kinds[msg.Id]
+		if !ok {
+			order = append(order, msg.Id)
+		}
+		// A label change on a message we haven't seen yet is still an addition.
+		if kind == labels && prev == added {
+			return
+		}
+		kinds[msg.Id] = kind
+	}
+
+	changes := &HistoryChanges{HistoryID: startHistoryID}
+	pageToken := ""
+	for {
+		req := i.svc.Users.History.List(authUser).StartHistoryId(startHistoryID).HistoryTypes("messageAdded", "messageDeleted", "labelAdded", "labelRemoved").MaxResults(maxListPageSize)
+		if pageToken != "" {
+			req = req.PageToken(pageToken)
+		}
+		resp, err := req.Context(ctx).Do()
+		if err != nil {
+			if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+				return nil, ErrHistoryExpired
+			}
+			return nil, errors.Wrapf(err, "Failed to list history starting at %d", startHistoryID)
+		}
+
+		for _, h := range resp.History {
+			for _, m := range h.MessagesAdded {
+				record(m.Message, added)
+			}
+			for _, m := range h.LabelsAdded {
+				record(m.Message, labels)
+			}
+			for _, m := range h.LabelsRemoved {
+				record(m.Message, labels)
+			}
+			for _, m := range h.MessagesDeleted {
+				record(m.Message, deleted)
+			}
+		}
+
+		changes.HistoryID = max(changes.HistoryID, resp.HistoryId)
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	for _, id := range order {
+		switch kinds[id] {
+		case added:
+			changes.Added = append(changes.Added, id)
+		case deleted:
+			changes.Deleted = append(changes.Deleted, id)
+		case labels:
+			changes.LabelsChanged = append(changes.LabelsChanged, id)
+		}
+	}
+	return changes, nil
+}
+
+// getLabelIDs returns the ids of the labels on the message. The boolean is false if the message no longer exists.
+func (i *Inbox) getLabelIDs(ctx context.Context, messageID string) ([]string, bool, error) {
+	var msg *gmail.Message
+	err := retry(ctx, func() error {
+		var err error
+		msg, err = i.svc.Users.Messages.Get(authUser, messageID).Format("minimal").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrapf(err, "Error retrieving message with id %s", messageID)
+	}
+	return msg.LabelIds, true, nil
+}
@@ -0,0 +1,297 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	// Labels are the names of labels to apply to the imported messages. Missing labels are created.
+	Labels []string
+	// Checkpoint is the path of the file recording the imported messages. If it is empty the checkpoint is kept
+	// next to the first path being imported.
+	Checkpoint string
+}
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	// Imported is the number of messages imported by this run.
+	Imported int
+	// Skipped is the number of messages that had already been imported.
+	Skipped int
+	// Checkpoint is the path of the checkpoint recording every imported message.
+	Checkpoint string
+}
+
+// importRecord records an imported message in the checkpoint.
+type importRecord struct {
+	ID       string `json:"id"`
+	ThreadID string `json:"threadId"`
+	// MessageID is the Message-Id header of the message.
+	MessageID string `json:"messageId,omitempty"`
+	// Path is the absolute path of the file the message was imported from.
+	Path string `json:"path"`
+	// Offset and Length locate the message in an mbox file.
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// importCheckpoint is the JSON lines file recording the imported messages.
+type importCheckpoint struct {
+	*jsonlFile
+	records []*importRecord
+}
+
+// openImportCheckpoint reads the checkpoint at path if it exists and opens it for appending.
+func openImportCheckpoint(path string) (*importCheckpoint, error) {
+	c := &importCheckpoint{}
+	f, err := openJSONL(path, func(line []byte) error {
+		r := &importRecord{}
+		if err := decodeJSONLRecord(line, r); err != nil {
+			return err
+		}
+		if r.ID == "" || r.Path == "" {
+			return errors.New("Record is missing the message id or path; is this an import checkpoint?")
+		}
+		c.records = append(c.records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.jsonlFile = f
+	return c, nil
+}
+
+// importSource is a message read from a file being imported.
+type importSource struct {
+	// File is the absolute path of the .eml or mbox file.
+	File string
+	// Offset is the offset of the message in an mbox file.
+	Offset int64
+	Data   []byte
+}
+
+// key identifies the message in the checkpoint.
+func (s *importSource) key() string {
+	return importKey(s.File, s.Offset)
+}
+
+// importKey identifies the message at offset in file.
+func importKey(file string, offset int64) string {
+	return file + "@" + strconv.FormatInt(offset, 10)
+}
+
+// Import adds the messages in paths to the mailbox the way gmail's own import does; the messages aren't sent and
+// keep the dates in their Date headers. paths can be .eml files, directories of .eml files or mbox files.
+//
+// Messages replying to a message that was already imported are added to its thread. Every imported message is
+// recorded in a checkpoint so an interrupted import can be rerun without creating duplicates.
+func (i *Inbox) Import(ctx context.Context, paths []string, opts ImportOptions) (*ImportResult, error) {
+	log := util.LoggerFromContext(ctx)
+	if len(paths) == 0 {
+		return nil, errors.New("No files to import")
+	}
+
+	labelIDs := make([]string, 0, len(opts.Labels))
+	for _, name := range opts.Labels {
+		l, err := i.GetLabel(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			l, err = i.CreateLabel(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		labelIDs = append(labelIDs, l.ID)
+	}
+
+	checkpointPath := opts.Checkpoint
+	if checkpointPath == "" {
+		checkpointPath = filepath.Clean(paths[0]) + ".import.jsonl"
+	}
+	checkpoint, err := openImportCheckpoint(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	defer checkpoint.Close()
+
+	imported := map[string]bool{}
+	// threads maps the Message-Id of imported messages to their gmail thread.
+	threads := map[string]string{}
+	for _, r := range checkpoint.records {
+		imported[importKey(r.Path, r.Offset)] = true
+		if r.MessageID != "" {
+			threads[r.MessageID] = r.ThreadID
+		}
+	}
+
+	result := &ImportResult{Checkpoint: checkpoint.path}
+	err = readImportSources(paths, func(src *importSource) error {
+		if imported[src.key()] {
+			result.Skipped++
+			return nil
+		}
+		messageID, parents := importThreadHeaders(src.Data)
+		threadID := ""
+		for _, p := range parents {
+			if id, ok := threads[p]; ok {
+				threadID = id
+				break
+			}
+		}
+
+		msg, err := i.importMessage(ctx, src.Data, labelIDs, threadID)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to import the message at offset %d of %s", src.Offset, src.File)
+		}
+		record := &importRecord{ID: msg.Id, ThreadID: msg.ThreadId, MessageID: messageID, Path: src.File, Offset: src.Offset, Length: int64(len(src.Data))}
+		if err := checkpoint.append(record); err != nil {
+			return err
+		}
+		imported[src.key()] = true
+		if messageID != "" {
+			threads[messageID] = msg.ThreadId
+		}
+		result.Imported++
+		if result.Imported%100 == 0 {
+			log.Info("Importing messages", "imported", result.Imported, "skipped", result.Skipped)
+		}
+		return nil
+	})
+	log.Info("Imported messages", "imported", result.Imported, "skipped", result.Skipped, "checkpoint", result.Checkpoint)
+	return result, err
+}
+
+// importMessage imports a single RFC 822 message.
+func (i *Inbox) importMessage(ctx context.Context, data []byte, labelIDs []string, threadID string) (*gmail.Message, error) {
+	var msg *gmail.Message
+	err := retry(ctx, func() error {
+		var err error
+		// The media is read when the request is sent so a new reader is needed for every attempt.
+		msg, err = i.svc.Users.Messages.Import(authUser, &gmail.Message{LabelIds: labelIDs, ThreadId: threadID}).
+			InternalDateSource("dateHeader").
+			NeverMarkSpam(true).
+			Media(bytes.NewReader(data), googleapi.ContentType("message/rfc822")).
+			Context(ctx).Do()
+		return err
+	})
+	return msg, err
+}
+
+// importThreadHeaders returns the Message-Id of the message and the ids of the messages it replies to with the
+// most likely thread first; In-Reply-To followed by References, last to first.
+func importThreadHeaders(data []byte) (string, []string) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return "", nil
+	}
+	parents := messageIDs(m.Header.Get("In-Reply-To"))
+	refs := messageIDs(m.Header.Get("References"))
+	for n := len(refs) - 1; n >= 0; n-- {
+		parents = append(parents, refs[n])
+	}
+	var messageID string
+	if ids := messageIDs(m.Header.Get("Message-Id")); len(ids) > 0 {
+		messageID = ids[0]
+	}
+	return messageID, parents
+}
+
+// messageIDs returns the message ids in a header such as References, without the angle brackets.
+func messageIDs(header string) []string {
+	var ids []string
+	for _, field := range strings.Fields(header) {
+		id := strings.Trim(field, "<>,")
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// readImportSources calls fn with every message in paths in order. Directories are walked for .eml files in
+// lexical order, .eml files are a single message and any other file is read as an mbox.
+func readImportSources(paths []string, fn func(src *importSource) error) error {
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to resolve %s", p)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to stat %s", p)
+		}
+		if !info.IsDir() {
+			if err := readImportFile(abs, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var files []string
+		err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".eml") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list .eml files in %s", p)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			if err := readImportFile(f, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readImportFile calls fn with the messages in an .eml or mbox file.
+func readImportFile(path string, fn func(src *importSource) error) error {
+	if strings.EqualFold(filepath.Ext(path), ".eml") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", path)
+		}
+		return fn(&importSource{File: path, Data: data})
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open mbox %s", path)
+	}
+	defer f.Close()
+	count := 0
+	err = readMbox(f, func(offset int64, msg []byte) error {
+		count++
+		return fn(&importSource{File: path, Offset: offset, Data: msg})
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read mbox %s", path)
+	}
+	if count == 0 {
+		return errors.Errorf("%s doesn't contain any messages; only .eml and mbox files can be imported", path)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeImport is a fake implementation of the import API. Label requests are served by fakeLabels.
+type fakeImport struct {
+	fakeLabels
+	// failAt is the number of the import request that fails; 0 means no request fails.
+	failAt   int
+	requests int
+	imported []*gmail.Message
+	raw      []string
+}
+
+func (f *fakeImport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/upload/gmail/v1/users/me/messages/import" {
+		f.fakeLabels.ServeHTTP(w, r)
+		return
+	}
+	f.requests++
+	if f.requests == f.failAt {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+	if q := r.URL.Query(); q.Get("internalDateSource") != "dateHeader" || q.Get("neverMarkSpam") != "true" {
+		f.t.Errorf("Unexpected import parameters %v", q)
+	}
+
+	// The metadata and the message are sent as a multipart/related body.
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		f.t.Fatalf("Error parsing content type: %v", err)
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	msg := &gmail.Message{}
+	part, err := mr.NextPart()
+	if err != nil {
+		f.t.Fatalf("Error reading metadata: %v", err)
+	}
+	if err := json.NewDecoder(part).Decode(msg); err != nil {
+		f.t.Fatalf("Error decoding metadata: %v", err)
+	}
+	part, err = mr.NextPart()
+	if err != nil {
+		f.t.Fatalf("Error reading message: %v", err)
+	}
+	raw, err := io.ReadAll(part)
+	if err != nil {
+		f.t.Fatalf("Error reading message: %v", err)
+	}
+
+	msg.Id = fmt.Sprintf("i%d", len(f.imported))
+	if msg.ThreadId == "" {
+		msg.ThreadId = "t" + msg.Id
+	}
+	f.imported = append(f.imported, msg)
+	f.raw = append(f.raw, string(raw))
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+func Test_ReadMbox(t *testing.T) {
+	msgs := []string{
+		"Subject: one\n\nFrom the start\n>From quoted\n",
+		"Subject: two\r\n\r\nbody\r\n\r\n",
+		"Subject: three\n\nno newline",
+	}
+	var mbox bytes.Buffer
+	for _, m := range msgs {
+		if _, err := writeMboxMessage(&mbox, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), []byte(m)); err != nil {
+			t.Fatalf("Error writing mbox: %v", err)
+		}
+	}
+
+	var got []string
+	var offsets []int64
+	err := readMbox(bytes.NewReader(mbox.Bytes()), func(offset int64, msg []byte) error {
+		got = append(got, string(msg))
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error reading mbox: %v", err)
+	}
+	expected := []string{msgs[0], msgs[1], msgs[2] + "\n"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected messages;\n got: %q\nwant: %q", got, expected)
+	}
+	for n, offset := range offsets {
+		if !bytes.HasPrefix(mbox.Bytes()[offset:], mboxFromPrefix) {
+			t.Errorf("Offset %d of message %d isn't the start of a From line", offset, n)
+		}
+	}
+}
+
+func Test_ImportNotMbox(t *testing.T) {
+	type testCase struct {
+		name     string
+		data     string
+		expected string
+	}
+	cases := []testCase{
+		{
+			name:     "no-separator",
+			data:     "Subject: Hi\n\nHi\n",
+			expected: "isn't an mbox",
+		},
+		{
+			name:     "content-before-separator",
+			data:     "notes\n\nFrom MAILER-DAEMON Mon Jan  1 00:00:00 2024\nSubject: Hi\n\nHi\n",
+			expected: "isn't an mbox",
+		},
+		{
+			name:     "empty",
+			data:     "\n",
+			expected: "doesn't contain any messages",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "note.msg")
+			if err := os.WriteFile(path, []byte(c.data), 0o644); err != nil {
+				t.Fatalf("Error writing file: %v", err)
+			}
+			f := &fakeImport{fakeLabels: fakeLabels{t: t, labels: map[string]*gmail.Label{}}}
+			inbox := newFakeInbox(t, f)
+			_, err := inbox.Import(context.Background(), []string{path}, ImportOptions{})
+			if err == nil || !strings.Contains(err.Error(), c.expected) {
+				t.Errorf("Expected an error containing %q; got %v", c.expected, err)
+			}
+			if len(f.imported) != 0 {
+				t.Errorf("Expected nothing to be imported; got %d messages", len(f.imported))
+			}
+		})
+	}
+}
+
+func Test_Import(t *testing.T) {
+	dir := t.TempDir()
+	var mbox bytes.Buffer
+	for _, m := range []string{
+		"Message-Id: <a@example.com>\nSubject: Plans\n\nHi\n",
+		"Message-Id: <b@example.com>\nSubject: Other\n\nUnrelated\n",
+		"Message-Id: <c@example.com>\nIn-Reply-To: <a@example.com>\nReferences: <a@example.com>\nSubject: Re: Plans\n\nSure\n",
+	} {
+		if _, err := writeMboxMessage(&mbox, time.Now(), []byte(m)); err != nil {
+			t.Fatalf("Error writing mbox: %v", err)
+		}
+	}
+	mboxPath := filepath.Join(dir, "old.mbox")
+	if err := os.WriteFile(mboxPath, mbox.Bytes(), 0o644); err != nil {
+		t.Fatalf("Error writing mbox: %v", err)
+	}
+	emlDir := filepath.Join(dir, "eml")
+	if err := os.MkdirAll(emlDir, 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	eml := "Message-Id: <d@example.com>\nReferences: <x@example.com> <c@example.com>\nSubject: Re: Plans\n\nGreat\n"
+	if err := os.WriteFile(filepath.Join(emlDir, "d.eml"), []byte(eml), 0o644); err != nil {
+		t.Fatalf("Error writing eml: %v", err)
+	}
+
+	f := &fakeImport{
+		fakeLabels: fakeLabels{t: t, labels: map[string]*gmail.Label{"INBOX": {Id: "INBOX", Name: "INBOX", Type: "system"}}},
+		failAt:     3,
+	}
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+	opts := ImportOptions{Labels: []string{"Archive/2019", "INBOX"}}
+	paths := []string{mboxPath, emlDir}
+
+	result, err := inbox.Import(ctx, paths, opts)
+	if err == nil {
+		t.Fatalf("Expected the import to fail on the third message")
+	}
+	if result.Imported != 2 || result.Checkpoint != mboxPath+".import.jsonl" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// Rerunning the import resumes after the messages that were imported.
+	result, err = inbox.Import(ctx, paths, opts)
+	if err != nil {
+		t.Fatalf("Error resuming the import: %v", err)
+	}
+	if result.Imported != 2 || result.Skipped != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if len(f.imported) != 4 {
+		t.Fatalf("Expected each message to be imported once; got %d", len(f.imported))
+	}
+
+	threads := make([]string, 0, len(f.imported))
+	for _, m := range f.imported {
+		threads = append(threads, m.ThreadId)
+	}
+	if expected := []string{"ti0", "ti1", "ti0", "ti0"}; !reflect.DeepEqual(threads, expected) {
+		t.Errorf("Expected replies to be added to the thread of the messages they reply to; got %v", threads)
+	}
+	if labels := f.imported[3].LabelIds; !reflect.DeepEqual(labels, []string{"Label_2", "INBOX"}) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if !strings.HasPrefix(f.raw[0], "Message-Id: <a@example.com>\n") || f.raw[3] != eml {
+		t.Errorf("Expected the messages to be uploaded unchanged; got %q", f.raw)
+	}
+}
+
+func Test_ImportWrongCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	eml := filepath.Join(dir, "a.eml")
+	if err := os.WriteFile(eml, []byte("Subject: Hi\n\nHi\n"), 0o644); err != nil {
+		t.Fatalf("Error writing eml: %v", err)
+	}
+	// An export manifest isn't an import checkpoint.
+	checkpoint := filepath.Join(dir, "manifest.jsonl")
+	if err := os.WriteFile(checkpoint, []byte(`{"id":"m0","threadId":"t0","date":"2024-01-01T00:00:00Z","file":"m0.eml"}`+"\n"), 0o644); err != nil {
+		t.Fatalf("Error writing manifest: %v", err)
+	}
+
+	f := &fakeImport{fakeLabels: fakeLabels{t: t, labels: map[string]*gmail.Label{}}}
+	inbox := newFakeInbox(t, f)
+	_, err := inbox.Import(context.Background(), []string{eml}, ImportOptions{Checkpoint: checkpoint})
+	if err == nil || !strings.Contains(err.Error(), "Failed to parse line 1") {
+		t.Errorf("Expected the checkpoint to be rejected; got %v", err)
+	}
+	if len(f.imported) != 0 {
+		t.Errorf("Expected nothing to be imported; got %d messages", len(f.imported))
+	}
+}
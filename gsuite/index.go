@@ -0,0 +1,563 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	// indexBatchSize is the number of messages fetched between saves of the index when updating it.
+	indexBatchSize = 100
+
+	// snippetLength is the number of characters of the body used as the snippet of indexed messages.
+	snippetLength = 200
+)
+
+// IndexedMessage is a message stored in the local index.
+type IndexedMessage struct {
+	ID       string
+	ThreadID string
+	From     string
+	To       string
+	Cc       string
+	Subject  string
+	Date     time.Time
+	Labels   []string
+	Body     string
+}
+
+// Index is a local full text index of messages. It lets messages that have already been fetched be searched
+// without going to gmail. The index is stored in a single file and is loaded into memory when it is opened.
+type Index struct {
+	path string
+	// historyID is the gmail history id the labels in the index are up to date with. It is 0 until the first update.
+	historyID uint64
+	messages  map[string]*IndexedMessage
+	// terms maps each word in the messages to the ids of the messages containing it.
+	terms map[string]map[string]bool
+}
+
+// OpenIndex opens the index stored at path. If the file doesn't exist an empty index is returned; it is created
+// when the index is saved.
+func OpenIndex(path string) (*Index, error) {
+	idx := &Index{
+		path:     path,
+		messages: map[string]*IndexedMessage{},
+		terms:    map[string]map[string]bool{},
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read index %s", path)
+	}
+
+	saved := &indexFile{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(saved); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode index %s", path)
+	}
+	idx.historyID = saved.HistoryID
+	for _, m := range saved.Messages {
+		idx.add(m)
+	}
+	return idx, nil
+}
+
+// indexFile is the format the index is saved in.
+type indexFile struct {
+	HistoryID uint64
+	Messages  []*IndexedMessage
+}
+
+// Len returns the number of messages in the index.
+func (x *Index) Len() int {
+	return len(x.messages)
+}
+
+// Has returns true if the message is in the index.
+func (x *Index) Has(id string) bool {
+	_, ok := x.messages[id]
+	return ok
+}
+
+// Add adds the message to the index replacing any previous version of it.
+func (x *Index) Add(msg *Email) {
+	x.add(&IndexedMessage{
+		ID:       msg.ID,
+		ThreadID: msg.ThreadID,
+		From:     msg.From,
+		To:       msg.To,
+		Cc:       msg.Cc,
+		Subject:  msg.Subject,
+		Date:     msg.Date,
+		Labels:   msg.Labels,
+		Body:     msg.Body,
+	})
+}
+
+func (x *Index) add(m *IndexedMessage) {
+	if _, ok := x.messages[m.ID]; ok {
+		x.remove(m.ID)
+	}
+	x.messages[m.ID] = m
+	for _, term := range indexTerms(m) {
+		ids, ok := x.terms[term]
+		if !ok {
+			ids = map[string]bool{}
+			x.terms[term] = ids
+		}
+		ids[m.ID] = true
+	}
+}
+
+// remove removes the message from the index.
+func (x *Index) remove(id string) {
+	m, ok := x.messages[id]
+	if !ok {
+		return
+	}
+	for _, term := range indexTerms(m) {
+		delete(x.terms[term], id)
+		if len(x.terms[term]) == 0 {
+			delete(x.terms, term)
+		}
+	}
+	delete(x.messages, id)
+}
+
+// Save writes the index to its file.
+func (x *Index) Save() error {
+	messages := make([]*IndexedMessage, 0, len(x.messages))
+	for _, m := range x.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(a, b int) bool {
+		return messages[a].ID < messages[b].ID
+	})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&indexFile{HistoryID: x.historyID, Messages: messages}); err != nil {
+		return errors.Wrapf(err, "Failed to encode index")
+	}
+	return writeFileAtomic(x.path, buf.Bytes())
+}
+
+// Search returns the indexed messages matching query, newest first. If maxResults is <= 0 all the matches are
+// returned.
+//
+// The query supports a subset of the gmail search operators: from:, to:, subject:, after:, before: and label:.
+// Other words match messages containing them in the headers or body and "quoted phrases" match messages containing
+// the phrase. Terms can be negated with a leading "-" and all terms must match.
+func (x *Index) Search(query string, maxResults int) ([]*EmailInfo, error) {
+	terms, err := parseLocalQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow the candidates using the inverted index for plain words; other terms are checked on each message.
+	var candidates map[string]bool
+	for _, t := range terms {
+		if t.negate || t.field != "" || strings.Contains(t.value, " ") {
+			continue
+		}
+		ids := x.terms[t.value]
+		if candidates == nil {
+			candidates = make(map[string]bool, len(ids))
+			for id := range ids {
+				candidates[id] = true
+			}
+			continue
+		}
+		for id := range candidates {
+			if !ids[id] {
+				delete(candidates, id)
+			}
+		}
+	}
+	if candidates == nil {
+		candidates = make(map[string]bool, len(x.messages))
+		for id := range x.messages {
+			candidates[id] = true
+		}
+	}
+
+	matches := make([]*IndexedMessage, 0, len(candidates))
+	for id := range candidates {
+		m := x.messages[id]
+		matched := true
+		for _, t := range terms {
+			if t.matches(m) == t.negate {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if !matches[a].Date.Equal(matches[b].Date) {
+			return matches[a].Date.After(matches[b].Date)
+		}
+		return matches[a].ID < matches[b].ID
+	})
+	if maxResults > 0 && len(matches) > maxResults {
+		matches = matches[:maxResults]
+	}
+
+	results := make([]*EmailInfo, 0, len(matches))
+	for _, m := range matches {
+		info := &EmailInfo{
+			ID:       m.ID,
+			ThreadID: m.ThreadID,
+			From:     m.From,
+			To:       m.To,
+			Cc:       m.Cc,
+			Subject:  m.Subject,
+			Snippet:  snippet(m.Body),
+			Date:     m.Date,
+			Labels:   m.Labels,
+		}
+		info.parseAddresses()
+		results = append(results, info)
+	}
+	return results, nil
+}
+
+// IndexResult summarizes an update of the index.
+type IndexResult struct {
+	// Added is the number of new messages added to the index.
+	Added int
+	// Updated is the number of indexed messages whose labels changed.
+	Updated int
+	// Removed is the number of indexed messages that were deleted or moved to the trash or spam.
+	Removed int
+}
+
+// UpdateIndex brings the messages already in the index up to date and adds the messages matching query that
+// aren't in it yet. Label changes and deletions since the last update are found with the history API; if there is
+// no history for the index, or it has expired, the labels of every indexed message are fetched. Messages that were
+// deleted or moved to the trash or spam are removed from the index. The index is saved after each batch of new
+// messages so an interrupted update doesn't have to refetch them.
+func (i *Inbox) UpdateIndex(ctx context.Context, index *Index, query string) (*IndexResult, error) {
+	log := util.LoggerFromContext(ctx)
+	result := &IndexResult{}
+
+	// Get the history id before refreshing so changes made during the update are picked up by the next one.
+	historyID, err := i.HistoryID(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err := i.refreshIndex(ctx, index, result); err != nil {
+		return result, err
+	}
+
+	ids, _, err := i.listMessageIDs(ctx, query, 0, "", false)
+	if err != nil {
+		return result, err
+	}
+
+	missing := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !index.Has(id) {
+			missing = append(missing, id)
+		}
+	}
+	log.Info("Updating index", "query", query, "matched", len(ids), "new", len(missing), "updated", result.Updated, "removed", result.Removed)
+
+	for start := 0; start < len(missing); start += indexBatchSize {
+		end := min(start+indexBatchSize, len(missing))
+		batch := missing[start:end]
+		msgs := make([]*Email, len(batch))
+		errs := make([]error, len(batch))
+		parallel(len(batch), i.fetchWorkers, func(n int) {
+			msgs[n], errs[n] = i.GetMessage(ctx, batch[n])
+		})
+		for n, msg := range msgs {
+			if errs[n] != nil {
+				log.Error(errs[n], "Error fetching message; it won't be indexed", "id", batch[n])
+				continue
+			}
+			index.Add(msg)
+			result.Added++
+		}
+		if err := index.Save(); err != nil {
+			return result, err
+		}
+	}
+
+	index.historyID = historyID
+	return result, index.Save()
+}
+
+// refreshIndex updates the labels of the indexed messages that changed since the index was last updated and
+// removes the ones that were deleted.
+func (i *Inbox) refreshIndex(ctx context.Context, index *Index, result *IndexResult) error {
+	log := util.LoggerFromContext(ctx)
+	if index.Len() == 0 {
+		return nil
+	}
+
+	var changed []string
+	if index.historyID != 0 {
+		changes, err := i.ListHistory(ctx, index.historyID)
+		switch {
+		case err == ErrHistoryExpired:
+			log.Info("Index history has expired; refreshing the labels of every indexed message")
+		case err != nil:
+			return err
+		default:
+			for _, id := range changes.Deleted {
+				if index.Has(id) {
+					index.remove(id)
+					result.Removed++
+				}
+			}
+			for _, id := range append(changes.Added, changes.LabelsChanged...) {
+				if index.Has(id) {
+					changed = append(changed, id)
+				}
+			}
+			return i.refreshIndexLabels(ctx, index, changed, result)
+		}
+	}
+
+	changed = make([]string, 0, index.Len())
+	for id := range index.messages {
+		changed = append(changed, id)
+	}
+	sort.Strings(changed)
+	return i.refreshIndexLabels(ctx, index, changed, result)
+}
+
+// refreshIndexLabels fetches the current labels of the indexed messages with the given ids.
+func (i *Inbox) refreshIndexLabels(ctx context.Context, index *Index, ids []string, result *IndexResult) error {
+	type labelResult struct {
+		labelIDs []string
+		exists   bool
+		err      error
+	}
+	results := make([]labelResult, len(ids))
+	parallel(len(ids), i.fetchWorkers, func(n int) {
+		r := &results[n]
+		r.labelIDs, r.exists, r.err = i.getLabelIDs(ctx, ids[n])
+	})
+
+	for n, id := range ids {
+		r := results[n]
+		if r.err != nil {
+			return r.err
+		}
+		if !r.exists || slices.Contains(r.labelIDs, trashLabel) || slices.Contains(r.labelIDs, spamLabel) {
+			index.remove(id)
+			result.Removed++
+			continue
+		}
+		labels := i.labelNames(ctx, r.labelIDs)
+		m := index.messages[id]
+		if sameStrings(m.Labels, labels) {
+			continue
+		}
+		updated := *m
+		updated.Labels = labels
+		index.add(&updated)
+		result.Updated++
+	}
+	return nil
+}
+
+// queryTerm is a single term of a local search query.
+type queryTerm struct {
+	// field is the operator without the colon; e.g. "from". It is empty for plain words and phrases.
+	field  string
+	value  string
+	negate bool
+	// date is the parsed value of after: and before:.
+	date time.Time
+}
+
+// localQueryFields are the operators supported by Index.Search.
+var localQueryFields = map[string]bool{
+	"from":    true,
+	"to":      true,
+	"subject": true,
+	"after":   true,
+	"before":  true,
+	"label":   true,
+}
+
+// parseLocalQuery splits the query into terms. Values are lower cased since matching is case insensitive.
+func parseLocalQuery(query string) ([]*queryTerm, error) {
+	terms := make([]*queryTerm, 0)
+	for _, token := range splitQuery(query) {
+		t := &queryTerm{}
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			t.negate = true
+			token = token[1:]
+		}
+		if idx := strings.Index(token, ":"); idx > 0 && !strings.HasPrefix(token, `"`) {
+			field := strings.ToLower(token[:idx])
+			if !localQueryFields[field] {
+				return nil, errors.Errorf("Search operator %s: isn't supported in local searches", field)
+			}
+			t.field = field
+			token = token[idx+1:]
+		}
+		t.value = strings.ToLower(strings.Trim(token, `"`))
+		if t.value == "" {
+			return nil, errors.Errorf("Search term %q is missing a value", token)
+		}
+
+		if t.field == "after" || t.field == "before" {
+			date, err := parseQueryDate(t.value)
+			if err != nil {
+				return nil, err
+			}
+			t.date = date
+		}
+		// Plain words are looked up in the inverted index so they need to be normalized the same way.
+		if t.field == "" && !strings.Contains(t.value, " ") {
+			words := tokenize(t.value)
+			if len(words) != 1 {
+				// Punctuation in a word splits it; treat it as a phrase.
+				t.value = strings.Join(words, " ")
+			} else {
+				t.value = words[0]
+			}
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// splitQuery splits the query on whitespace outside of double quotes.
+func splitQuery(query string) []string {
+	tokens := make([]string, 0)
+	var current strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// parseQueryDate parses dates in the formats gmail accepts; e.g. 2024/01/31, 2024-01-31 or seconds since the epoch.
+// Like gmail, a date means midnight at the start of the day in the local time zone.
+func parseQueryDate(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	for _, layout := range []string{"2006/01/02", "2006-01-02", "2006/1/2", "2006-1-2"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("Invalid date %q; dates must be formatted like 2006/01/02", value)
+}
+
+// matches returns true if the message matches the term ignoring whether it is negated.
+func (t *queryTerm) matches(m *IndexedMessage) bool {
+	switch t.field {
+	case "from":
+		return strings.Contains(strings.ToLower(m.From), t.value)
+	case "to":
+		return strings.Contains(strings.ToLower(m.To), t.value) || strings.Contains(strings.ToLower(m.Cc), t.value)
+	case "subject":
+		return containsText(m.Subject, t.value)
+	case "after":
+		return !m.Date.Before(t.date)
+	case "before":
+		return m.Date.Before(t.date)
+	case "label":
+		for _, l := range m.Labels {
+			if labelMatches(l, t.value) {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(t.value, " ") {
+		for _, w := range tokenize(messageText(m)) {
+			if w == t.value {
+				return true
+			}
+		}
+		return false
+	}
+	return containsText(messageText(m), t.value)
+}
+
+// labelMatches returns true if the query value refers to the label. Gmail lets spaces and slashes in label names
+// be written as dashes; e.g. label:work-projects matches Work/Projects.
+func labelMatches(label string, value string) bool {
+	label = strings.ToLower(label)
+	if label == value {
+		return true
+	}
+	return strings.NewReplacer(" ", "-", labelSeparator, "-").Replace(label) == value
+}
+
+// containsText returns true if text contains the words of value in order ignoring case and punctuation.
+func containsText(text string, value string) bool {
+	return strings.Contains(" "+strings.Join(tokenize(text), " ")+" ", " "+strings.Join(tokenize(value), " ")+" ")
+}
+
+// messageText is the text searched by plain words and phrases.
+func messageText(m *IndexedMessage) string {
+	return strings.Join([]string{m.From, m.To, m.Cc, m.Subject, m.Body}, "\n")
+}
+
+// indexTerms returns the distinct words in the message.
+func indexTerms(m *IndexedMessage) []string {
+	seen := map[string]bool{}
+	terms := make([]string, 0)
+	for _, w := range tokenize(messageText(m)) {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// tokenize splits text into lower case words of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// snippet returns the start of the body with whitespace collapsed.
+func snippet(body string) string {
+	s := strings.Join(strings.Fields(body), " ")
+	if r := []rune(s); len(r) > snippetLength {
+		return string(r[:snippetLength])
+	}
+	return s
+}
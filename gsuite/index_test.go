@@ -0,0 +1,237 @@
+package gsuite
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	t.Helper()
+	idx, err := OpenIndex(filepath.Join(t.TempDir(), "index.gob"))
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	messages := []*Email{
+		{
+			ID:      "m0",
+			From:    "Alice <alice@example.com>",
+			To:      "bob@example.com",
+			Subject: "Quarterly report",
+			Body:    "The numbers for Q3 are attached.",
+			Date:    time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local),
+			Labels:  []string{"INBOX", "Work/Reports"},
+		},
+		{
+			ID:      "m1",
+			From:    "bob@example.com",
+			To:      "alice@example.com",
+			Cc:      "carol@example.com",
+			Subject: "Re: Quarterly report",
+			Body:    "Thanks! The report looks great.",
+			Date:    time.Date(2024, 1, 11, 9, 0, 0, 0, time.Local),
+			Labels:  []string{"SENT"},
+		},
+		{
+			ID:      "m2",
+			From:    "news@example.org",
+			To:      "alice@example.com",
+			Subject: "Weekly digest",
+			Body:    "Top stories this week.",
+			Date:    time.Date(2024, 2, 1, 8, 0, 0, 0, time.Local),
+			Labels:  []string{"INBOX", "Newsletters"},
+		},
+	}
+	for _, m := range messages {
+		idx.Add(m)
+	}
+	return idx
+}
+
+func Test_IndexSearch(t *testing.T) {
+	type testCase struct {
+		name     string
+		query    string
+		expected []string
+	}
+	cases := []testCase{
+		{name: "word", query: "report", expected: []string{"m1", "m0"}},
+		{name: "case-insensitive", query: "REPORT", expected: []string{"m1", "m0"}},
+		{name: "phrase", query: `"looks great"`, expected: []string{"m1"}},
+		{name: "from", query: "from:alice", expected: []string{"m0"}},
+		{name: "to-includes-cc", query: "to:carol@example.com", expected: []string{"m1"}},
+		{name: "subject", query: "subject:digest", expected: []string{"m2"}},
+		{name: "subject-phrase", query: `subject:"quarterly report"`, expected: []string{"m1", "m0"}},
+		{name: "after", query: "after:2024/01/11", expected: []string{"m2", "m1"}},
+		{name: "before", query: "before:2024-01-11", expected: []string{"m0"}},
+		{name: "after-epoch", query: NewQuery().After(time.Date(2024, 1, 10, 13, 0, 0, 0, time.Local)).String(), expected: []string{"m2", "m1"}},
+		{name: "label", query: "label:work-reports", expected: []string{"m0"}},
+		{name: "label-name", query: "label:newsletters", expected: []string{"m2"}},
+		{name: "negate", query: "report -label:sent", expected: []string{"m0"}},
+		{name: "and", query: "from:bob thanks", expected: []string{"m1"}},
+		{name: "no-match", query: "missing", expected: []string{}},
+	}
+	idx := newTestIndex(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			results, err := idx.Search(c.query, 0)
+			if err != nil {
+				t.Fatalf("Error searching: %v", err)
+			}
+			actual := make([]string, 0, len(results))
+			for _, r := range results {
+				actual = append(actual, r.ID)
+			}
+			if !reflect.DeepEqual(c.expected, actual) {
+				t.Errorf("Got %v; want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_IndexSearchErrors(t *testing.T) {
+	idx := newTestIndex(t)
+	for _, query := range []string{"has:attachment", "after:yesterday", "from:"} {
+		if _, err := idx.Search(query, 0); err == nil {
+			t.Errorf("Expected an error for query %q", query)
+		}
+	}
+}
+
+func Test_IndexSaveAndReplace(t *testing.T) {
+	idx := newTestIndex(t)
+	// Adding a message again replaces it.
+	idx.Add(&Email{ID: "m2", Subject: "Monthly digest", Labels: []string{"INBOX"}})
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Error saving index: %v", err)
+	}
+
+	loaded, err := OpenIndex(idx.path)
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	if loaded.Len() != 3 {
+		t.Errorf("Expected 3 messages; got %d", loaded.Len())
+	}
+	if results, _ := loaded.Search("weekly", 0); len(results) != 0 {
+		t.Errorf("Expected the replaced message's words to be removed; got %+v", results)
+	}
+	if results, _ := loaded.Search("monthly", 0); len(results) != 1 {
+		t.Errorf("Expected the new version of the message to be indexed; got %+v", results)
+	}
+	if results, _ := loaded.Search("report", 1); len(results) != 1 || results[0].ID != "m1" {
+		t.Errorf("Expected the newest match; got %+v", results)
+	}
+}
+
+func Test_UpdateIndex(t *testing.T) {
+	f := &fakeMessages{t: t, count: 5}
+	inbox := newFakeInbox(t, f)
+	idx, err := OpenIndex(filepath.Join(t.TempDir(), "index.gob"))
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+
+	result, err := inbox.UpdateIndex(context.Background(), idx, "")
+	if err != nil {
+		t.Fatalf("Error updating index: %v", err)
+	}
+	if result.Added != 5 || idx.Len() != 5 {
+		t.Errorf("Expected 5 messages to be added; added %d, index has %d", result.Added, idx.Len())
+	}
+	results, err := idx.Search("subject:m3", 0)
+	if err != nil || len(results) != 1 || results[0].ID != "m3" {
+		t.Errorf("Expected to find m3 by subject; got %+v, %v", results, err)
+	}
+
+	// Messages that are already indexed aren't fetched again.
+	f.count = 6
+	result, err = inbox.UpdateIndex(context.Background(), idx, "")
+	if err != nil {
+		t.Fatalf("Error updating index: %v", err)
+	}
+	if result.Added != 1 {
+		t.Errorf("Expected only the new message to be added; added %d", result.Added)
+	}
+
+	loaded, err := OpenIndex(idx.path)
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	if loaded.Len() != 6 {
+		t.Errorf("Expected the saved index to have 6 messages; got %d", loaded.Len())
+	}
+}
+
+func Test_UpdateIndexRefresh(t *testing.T) {
+	f := &fakeMailbox{
+		t: t,
+		messages: map[string][]string{
+			"a": {"INBOX"},
+			"b": {"INBOX"},
+			"c": {"Label_1"},
+			"d": {"INBOX"},
+		},
+		historyID: 10,
+		matching:  []string{"a", "b", "c", "d"},
+	}
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+	// Like gmail, messages in the trash or spam don't match the query.
+	const query = "newer_than:1y"
+	idx, err := OpenIndex(filepath.Join(t.TempDir(), "index.gob"))
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	if _, err := inbox.UpdateIndex(ctx, idx, query); err != nil {
+		t.Fatalf("Error updating index: %v", err)
+	}
+
+	f.messages["a"] = []string{"Label_1"}
+	delete(f.messages, "b")
+	f.messages["c"] = []string{"TRASH"}
+	f.matching = []string{"a", "d"}
+	f.history = []*gmail.History{
+		{LabelsAdded: []*gmail.HistoryLabelAdded{{Message: &gmail.Message{Id: "a"}}}},
+		{MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: "b"}}}},
+		{LabelsAdded: []*gmail.HistoryLabelAdded{{Message: &gmail.Message{Id: "c"}}}},
+	}
+	f.historyStart = 10
+	f.historyID = 20
+
+	result, err := inbox.UpdateIndex(ctx, idx, query)
+	if err != nil {
+		t.Fatalf("Error updating index: %v", err)
+	}
+	if result.Added != 0 || result.Updated != 1 || result.Removed != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	results, err := idx.Search("label:Work/Projects", 0)
+	if err != nil || len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected only a to have the label; got %+v, %v", results, err)
+	}
+
+	loaded, err := OpenIndex(idx.path)
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	if loaded.historyID != 20 || loaded.Len() != 2 {
+		t.Errorf("Expected the saved index to be at history 20 with 2 messages; got %d with %d", loaded.historyID, loaded.Len())
+	}
+
+	// Without history the labels of every indexed message are refreshed.
+	f.expired = true
+	f.messages["d"] = []string{"SPAM"}
+	f.matching = []string{"a"}
+	result, err = inbox.UpdateIndex(ctx, idx, query)
+	if err != nil {
+		t.Fatalf("Error updating index: %v", err)
+	}
+	if result.Removed != 1 || idx.Has("d") {
+		t.Errorf("Expected d to be removed; got %+v", result)
+	}
+}
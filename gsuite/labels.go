@@ -0,0 +1,283 @@
+package gsuite
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+const (
+	// labelSeparator separates the components of nested label names; e.g. "Vendors/Acme".
+	labelSeparator = "/"
+
+	// batchModifyLimit is the maximum number of messages that can be modified in a single BatchModify request.
+	batchModifyLimit = 1000
+)
+
+// Label is a gmail label.
+type Label struct {
+	ID   string
+	Name string
+	// Type is "system" for labels gmail creates (e.g. INBOX) and "user" for labels created by the user.
+	Type string
+}
+
+// ListLabels returns all the labels sorted by name.
+func (i *Inbox) ListLabels(ctx context.Context) ([]*Label, error) {
+	// Hold the lock while fetching so concurrent callers don't all fetch the labels.
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.labels != nil {
+		return i.labels, nil
+	}
+	response, err := i.svc.Users.Labels.List(authUser).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list labels")
+	}
+
+	labels := make([]*Label, 0, len(response.Labels))
+	for _, l := range response.Labels {
+		labels = append(labels, &Label{ID: l.Id, Name: l.Name, Type: l.Type})
+	}
+	sort.Slice(labels, func(a, b int) bool {
+		return labels[a].Name < labels[b].Name
+	})
+	i.labels = labels
+	return labels, nil
+}
+
+// GetLabel returns the label whose name or id is nameOrID. Names are matched case insensitively like gmail does.
+// It returns nil if there is no such label.
+func (i *Inbox) GetLabel(ctx context.Context, nameOrID string) (*Label, error) {
+	labels, err := i.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if l.ID == nameOrID || strings.EqualFold(l.Name, nameOrID) {
+			return l, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateLabel creates the label. Nested labels are created along with any missing parents so that they show up
+// nested in the gmail UI. If the label already exists it is returned.
+func (i *Inbox) CreateLabel(ctx context.Context, name string) (*Label, error) {
+	log := util.LoggerFromContext(ctx)
+	name = strings.Trim(name, labelSeparator)
+	if name == "" {
+		return nil, errors.New("Label name can't be empty")
+	}
+
+	var label *Label
+	for _, piece := range strings.Split(name, labelSeparator) {
+		// Build the name from the parent's name so that we use the case of existing labels.
+		current := piece
+		if label != nil {
+			current = label.Name + labelSeparator + piece
+		}
+		existing, err := i.GetLabel(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			label = existing
+			continue
+		}
+
+		created, err := i.svc.Users.Labels.Create(authUser, &gmail.Label{
+			Name:                  current,
+			LabelListVisibility:   "labelShow",
+			MessageListVisibility: "show",
+		}).Context(ctx).Do()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create label %s", current)
+		}
+		log.Info("Created label", "name", current, "id", created.Id)
+		label = &Label{ID: created.Id, Name: created.Name, Type: created.Type}
+		i.resetLabels()
+	}
+	return label, nil
+}
+
+// DeleteLabel deletes the label. The label is removed from all messages but the messages aren't deleted.
+// If recursive is true the nested labels under it are deleted too.
+func (i *Inbox) DeleteLabel(ctx context.Context, name string, recursive bool) error {
+	log := util.LoggerFromContext(ctx)
+	label, err := i.userLabel(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	toDelete := []*Label{label}
+	if recursive {
+		children, err := i.childLabels(ctx, label)
+		if err != nil {
+			return err
+		}
+		toDelete = append(toDelete, children...)
+	}
+
+	defer i.resetLabels()
+	for _, l := range toDelete {
+		if err := i.svc.Users.Labels.Delete(authUser, l.ID).Context(ctx).Do(); err != nil {
+			return errors.Wrapf(err, "Failed to delete label %s", l.Name)
+		}
+		log.Info("Deleted label", "name", l.Name, "id", l.ID)
+	}
+	return nil
+}
+
+// RenameLabel renames the label. Nested labels under it are renamed too so that they stay nested.
+func (i *Inbox) RenameLabel(ctx context.Context, name string, newName string) error {
+	log := util.LoggerFromContext(ctx)
+	newName = strings.Trim(newName, labelSeparator)
+	if newName == "" {
+		return errors.New("Label name can't be empty")
+	}
+	label, err := i.userLabel(ctx, name)
+	if err != nil {
+		return err
+	}
+	children, err := i.childLabels(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	// If the new name is nested make sure its parents exist.
+	if idx := strings.LastIndex(newName, labelSeparator); idx > 0 {
+		if _, err := i.CreateLabel(ctx, newName[:idx]); err != nil {
+			return err
+		}
+	}
+
+	defer i.resetLabels()
+	for _, l := range append([]*Label{label}, children...) {
+		// Children are matched case insensitively so we can't use TrimPrefix.
+		renamed := newName + l.Name[len(label.Name):]
+		if _, err := i.svc.Users.Labels.Patch(authUser, l.ID, &gmail.Label{Name: renamed}).Context(ctx).Do(); err != nil {
+			return errors.Wrapf(err, "Failed to rename label %s to %s", l.Name, renamed)
+		}
+		log.Info("Renamed label", "id", l.ID, "from", l.Name, "to", renamed)
+	}
+	return nil
+}
+
+// ModifyLabels adds and removes labels from the messages. Labels can be specified by name or id.
+func (i *Inbox) ModifyLabels(ctx context.Context, messageIDs []string, add []string, remove []string) error {
+	addIDs, err := i.labelIDs(ctx, add)
+	if err != nil {
+		return err
+	}
+	removeIDs, err := i.labelIDs(ctx, remove)
+	if err != nil {
+		return err
+	}
+	return i.batchModify(ctx, messageIDs, addIDs, removeIDs)
+}
+
+// batchModify adds and removes label ids from the messages in batches of the maximum size gmail allows.
+func (i *Inbox) batchModify(ctx context.Context, messageIDs []string, addIDs []string, removeIDs []string) error {
+	for start := 0; start < len(messageIDs); start += batchModifyLimit {
+		end := start + batchModifyLimit
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		req := &gmail.BatchModifyMessagesRequest{
+			Ids:            messageIDs[start:end],
+			AddLabelIds:    addIDs,
+			RemoveLabelIds: removeIDs,
+		}
+		if err := i.svc.Users.Messages.BatchModify(authUser, req).Context(ctx).Do(); err != nil {
+			return errors.Wrapf(err, "Failed to modify labels of %d messages", end-start)
+		}
+	}
+	return nil
+}
+
+// resetLabels clears the cached labels so they are refetched after they are modified.
+func (i *Inbox) resetLabels() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.labels = nil
+}
+
+// labelIDs converts label names or ids to ids.
+func (i *Inbox) labelIDs(ctx context.Context, names []string) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		l, err := i.GetLabel(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			return nil, errors.Errorf("Label %s doesn't exist", name)
+		}
+		ids = append(ids, l.ID)
+	}
+	return ids, nil
+}
+
+// labelNames converts label ids to names. If the labels can't be fetched the ids are returned.
+func (i *Inbox) labelNames(ctx context.Context, ids []string) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	labels, err := i.ListLabels(ctx)
+	if err != nil {
+		log := util.LoggerFromContext(ctx)
+		log.Error(err, "Failed to list labels; label ids won't be resolved to names")
+		return ids
+	}
+
+	byID := make(map[string]string, len(labels))
+	for _, l := range labels {
+		byID[l.ID] = l.Name
+	}
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := byID[id]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, id)
+		}
+	}
+	return names
+}
+
+// userLabel returns the user label with the given name or an error if it doesn't exist. System labels can't be
+// modified.
+func (i *Inbox) userLabel(ctx context.Context, name string) (*Label, error) {
+	label, err := i.GetLabel(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if label == nil {
+		return nil, errors.Errorf("Label %s doesn't exist", name)
+	}
+	if label.Type == "system" {
+		return nil, errors.Errorf("Label %s is a system label and can't be modified", name)
+	}
+	return label, nil
+}
+
+// childLabels returns the labels nested under label.
+func (i *Inbox) childLabels(ctx context.Context, label *Label) ([]*Label, error) {
+	labels, err := i.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.ToLower(label.Name + labelSeparator)
+	children := make([]*Label, 0)
+	for _, l := range labels {
+		if strings.HasPrefix(strings.ToLower(l.Name), prefix) {
+			children = append(children, l)
+		}
+	}
+	return children, nil
+}
@@ -0,0 +1,118 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeLabels is a fake implementation of the labels API.
+type fakeLabels struct {
+	t      *testing.T
+	labels map[string]*gmail.Label
+}
+
+func (f *fakeLabels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/labels"
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	var resp interface{}
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		list := &gmail.ListLabelsResponse{}
+		for _, l := range f.labels {
+			list.Labels = append(list.Labels, l)
+		}
+		resp = list
+	case r.Method == http.MethodGet:
+		l, ok := f.labels[id]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		resp = l
+	case r.Method == http.MethodPost:
+		l := &gmail.Label{}
+		if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+			f.t.Errorf("Error decoding label: %v", err)
+		}
+		l.Id = fmt.Sprintf("Label_%d", len(f.labels))
+		l.Type = "user"
+		f.labels[l.Id] = l
+		resp = l
+	case r.Method == http.MethodPatch:
+		patch := &gmail.Label{}
+		if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+			f.t.Errorf("Error decoding label: %v", err)
+		}
+		f.labels[id].Name = patch.Name
+		resp = f.labels[id]
+	case r.Method == http.MethodDelete:
+		delete(f.labels, id)
+		return
+	default:
+		f.t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+func (f *fakeLabels) names() []string {
+	names := make([]string, 0, len(f.labels))
+	for _, l := range f.labels {
+		names = append(names, l.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Test_Labels(t *testing.T) {
+	fake := &fakeLabels{
+		t: t,
+		labels: map[string]*gmail.Label{
+			"INBOX":   {Id: "INBOX", Name: "INBOX", Type: "system"},
+			"Label_a": {Id: "Label_a", Name: "Vendors", Type: "user"},
+		},
+	}
+	inbox := newFakeInbox(t, fake)
+	ctx := context.Background()
+
+	if _, err := inbox.CreateLabel(ctx, "vendors/Acme/Invoices"); err != nil {
+		t.Fatalf("Error creating label: %v", err)
+	}
+	expected := "INBOX,Vendors,Vendors/Acme,Vendors/Acme/Invoices"
+	if actual := strings.Join(fake.names(), ","); actual != expected {
+		t.Fatalf("Expected labels %s; got %s", expected, actual)
+	}
+
+	if err := inbox.RenameLabel(ctx, "Vendors", "Suppliers"); err != nil {
+		t.Fatalf("Error renaming label: %v", err)
+	}
+	expected = "INBOX,Suppliers,Suppliers/Acme,Suppliers/Acme/Invoices"
+	if actual := strings.Join(fake.names(), ","); actual != expected {
+		t.Fatalf("Expected labels %s; got %s", expected, actual)
+	}
+
+	names := inbox.labelNames(ctx, []string{"INBOX", "Label_a", "Label_unknown"})
+	if actual := strings.Join(names, ","); actual != "INBOX,Suppliers,Label_unknown" {
+		t.Errorf("Unexpected label names %s", actual)
+	}
+
+	if err := inbox.DeleteLabel(ctx, "INBOX", false); err == nil {
+		t.Errorf("Expected an error deleting a system label")
+	}
+
+	if err := inbox.DeleteLabel(ctx, "suppliers", true); err != nil {
+		t.Fatalf("Error deleting label: %v", err)
+	}
+	if actual := strings.Join(fake.names(), ","); actual != "INBOX" {
+		t.Errorf("Expected only INBOX to remain; got %s", actual)
+	}
+}
@@ -2,8 +2,11 @@ package gsuite
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jlewi/gctl/config"
@@ -21,33 +24,132 @@ func NewInbox(cfg config.Config, ts oauth2.TokenSource) (*Inbox, error) {
 		return nil, fmt.Errorf("unable to create Gmail client: %v", err)
 	}
 	return &Inbox{
-		config: cfg,
-		svc:    svc,
+		config:       cfg,
+		svc:          svc,
+		fetchWorkers: cfg.GetFetchWorkers(),
 	}, nil
 }
 
+const (
+	// authUser is the special value gmail uses to indicate the authenticated user.
+	authUser = "me"
+
+	// maxListPageSize is the maximum page size gmail allows when listing messages.
+	maxListPageSize = 500
+)
+
 type EmailInfo struct {
-	ID      string
-	From    string
-	To      string
-	Subject string
+	ID       string
+	ThreadID string
+	From     string
+	To       string
+	Cc       string
+	Bcc      string
+	ReplyTo  string
+	// FromAddresses, ToAddresses, CcAddresses, BccAddresses and ReplyToAddresses are parsed from the raw headers
+	// above.
+	FromAddresses    []*Address `json:",omitempty"`
+	ToAddresses      []*Address `json:",omitempty"`
+	CcAddresses      []*Address `json:",omitempty"`
+	BccAddresses     []*Address `json:",omitempty"`
+	ReplyToAddresses []*Address `json:",omitempty"`
+	Subject          string
+	// MessageID is the value of the Message-ID header.
+	MessageID string
+	InReplyTo string
+	// ListID is the value of the List-Id header mailing lists add.
+	ListID  string
 	Snippet string
-	Date    time.Time
+	// Date is the time gmail received the message.
+	Date time.Time
+	// HeaderDate is the time in the Date header set by the sender. It is zero if the header is missing or invalid.
+	HeaderDate time.Time
+	// Size is gmail's estimate of the size of the message in bytes.
+	Size int64
+	// Labels are the names of the labels applied to the message.
+	Labels []string
+	// LabelIDs are the ids of the labels applied to the message.
+	LabelIDs []string
+	// Headers are the extra headers requested with SetExtraHeaders keyed by their canonical name.
+	Headers map[string]string `json:",omitempty"`
 }
 
 type Email struct {
-	ID      string
-	From    string
-	To      string
-	Subject string
-	Body    string
-	Date    time.Time
+	ID       string
+	ThreadID string
+	From     string
+	To       string
+	Cc       string
+	Bcc      string
+	ReplyTo  string
+	// FromAddresses, ToAddresses, CcAddresses, BccAddresses and ReplyToAddresses are parsed from the raw headers
+	// above.
+	FromAddresses    []*Address `json:",omitempty"`
+	ToAddresses      []*Address `json:",omitempty"`
+	CcAddresses      []*Address `json:",omitempty"`
+	BccAddresses     []*Address `json:",omitempty"`
+	ReplyToAddresses []*Address `json:",omitempty"`
+	Subject          string
+	// MessageID is the value of the Message-ID header. It is used to thread replies.
+	MessageID  string
+	InReplyTo  string
+	References string
+	// ListID is the value of the List-Id header mailing lists add.
+	ListID string
+	// Body is the plain text body of the message. If the message doesn't have a plain text body it is the HTML body.
+	Body string
+	// TextBody is the concatenation of the inline text/plain parts of the message.
+	TextBody string
+	// HTMLBody is the concatenation of the inline text/html parts of the message.
+	HTMLBody string
+	// Date is the time gmail received the message.
+	Date time.Time
+	// HeaderDate is the time in the Date header set by the sender. It is zero if the header is missing or invalid.
+	HeaderDate time.Time
+	// Size is gmail's estimate of the size of the message in bytes.
+	Size int64
+	// Labels are the names of the labels applied to the message.
+	Labels []string
+	// LabelIDs are the ids of the labels applied to the message.
+	LabelIDs []string
+	// Headers are the extra headers requested with SetExtraHeaders keyed by their canonical name.
+	Headers map[string]string `json:",omitempty"`
+	// Payload is the root of the MIME tree of the message.
+	Payload *MessagePart
 }
 
 // Inbox is a struct that provides routines for interacting with your inbox.
 type Inbox struct {
 	config config.Config
 	svc    *gmail.Service
+	// fetchWorkers is the number of messages to fetch concurrently.
+	fetchWorkers int
+	// extraHeaders are the canonical names of headers to fetch in addition to infoHeaders.
+	extraHeaders []string
+
+	// mu protects the cached values below since messages are fetched concurrently.
+	mu sync.Mutex
+	// address is the email address of the authenticated user. It is lazily fetched by EmailAddress.
+	address string
+	// labels caches the user's labels. It is lazily fetched by ListLabels and reset when labels are modified.
+	labels []*Label
+	// sendAs caches the user's send-as aliases. It is lazily fetched by ListSendAs and reset when they are modified.
+	sendAs []*SendAs
+}
+
+// EmailAddress returns the email address of the authenticated user.
+func (i *Inbox) EmailAddress(ctx context.Context) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.address != "" {
+		return i.address, nil
+	}
+	profile, err := i.svc.Users.GetProfile(authUser).Context(ctx).Do()
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get the gmail profile")
+	}
+	i.address = profile.EmailAddress
+	return i.address, nil
 }
 
 func (i *Inbox) GetMessage(ctx context.Context, messageID string) (*Email, error) {
@@ -63,89 +165,297 @@ func (i *Inbox) GetMessage(ctx context.Context, messageID string) (*Email, error
 		return nil, errors.Wrapf(err, "Error retrieving message with id %s", messageID)
 	}
 
-	msg := &Email{
-		Date: parseEpochMillis(fullMsg.InternalDate).Local(),
+	msg, err := newEmail(fullMsg)
+	msg.Labels = i.labelNames(ctx, fullMsg.LabelIds)
+	if fullMsg.Payload != nil {
+		msg.Headers = pickHeaders(fullMsg.Payload.Headers, i.extraHeaders)
 	}
-	for _, header := range fullMsg.Payload.Headers {
-		switch header.Name {
-		case "From":
-			msg.From = header.Value
-		case "To":
-			msg.To = header.Value
-		case "Subject":
-			msg.Subject = header.Value
-		}
+	return msg, err
+}
+
+// Search returns the messages matching the query. It fetches pages until it has maxResults messages or there are
+// no more results; if maxResults is <= 0 all the matching messages are returned. It returns the page token to pass
+// to a subsequent call to continue where this one stopped; the token is empty when there are no more results.
+func (i *Inbox) Search(ctx context.Context, query string, maxResults int64, pageToken string) ([]*EmailInfo, string, error) {
+	ids, nextPageToken, err := i.listMessageIDs(ctx, query, maxResults, pageToken, false)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// The body isn't always set for certain types of messages
-	// https://developers.google.com/gmail/api/reference/rest/v1/users.messages#Message.MessagePart
-	if fullMsg.Payload.Body.Data != "" {
-		decoded, err := base64.URLEncoding.DecodeString(fullMsg.Payload.Body.Data)
+	// The search request only returns the id and threadId so we need to fetch the metadata of each message.
+	return i.fetchInfos(ctx, ids), nextPageToken, nil
+}
+
+// ListMessageIDs returns the ids of up to maxResults messages matching the query without fetching the messages. If
+// maxResults is <= 0 all the matching messages are returned.
+func (i *Inbox) ListMessageIDs(ctx context.Context, query string, maxResults int64) ([]string, error) {
+	ids, _, err := i.listMessageIDs(ctx, query, maxResults, "", false)
+	return ids, err
+}
+
+// listMessageIDs returns the ids of up to maxResults messages matching the query starting at pageToken. If
+// maxResults is <= 0 all the matching messages are returned. It also returns the token for the next page.
+func (i *Inbox) listMessageIDs(ctx context.Context, query string, maxResults int64, pageToken string, includeSpamTrash bool) ([]string, string, error) {
+	ids := make([]string, 0)
+	for {
+		// Only request as many messages as we still need so the next page token doesn't skip any messages.
+		pageSize := int64(maxListPageSize)
+		if maxResults > 0 {
+			pageSize = min(pageSize, maxResults-int64(len(ids)))
+		}
+
+		req := i.svc.Users.Messages.List(authUser).Q(query).MaxResults(pageSize).IncludeSpamTrash(includeSpamTrash)
+		if pageToken != "" {
+			req = req.PageToken(pageToken)
+		}
+		response, err := req.Context(ctx).Do()
 		if err != nil {
-			return msg, fmt.Errorf("failed to decode base64 URL-encoded string: %v", err)
+			return nil, "", errors.Wrapf(err, "unable to search Gmail")
+		}
+		for _, m := range response.Messages {
+			ids = append(ids, m.Id)
+		}
+
+		pageToken = response.NextPageToken
+		if pageToken == "" || (maxResults > 0 && int64(len(ids)) >= maxResults) {
+			return ids, pageToken, nil
 		}
-		msg.Body = string(decoded)
 	}
+}
 
-	if len(fullMsg.Payload.Parts) > 0 {
-		for _, part := range fullMsg.Payload.Parts {
-			if part.MimeType == "text/plain" || part.MimeType == "text/html" {
-				decoded, err := base64.URLEncoding.DecodeString(part.Body.Data)
-				if err != nil {
-					return msg, fmt.Errorf("failed to decode base64 URL-encoded string: %v", err)
-				}
-				msg.Body += string(decoded)
-			}
+// SetFetchWorkers sets the number of messages to fetch concurrently.
+func (i *Inbox) SetFetchWorkers(n int) {
+	if n > 0 {
+		i.fetchWorkers = n
+	}
+}
+
+// SetExtraHeaders sets headers to fetch in addition to the ones EmailInfo and Email have fields for. Their values
+// are returned in the Headers field. Header names are case insensitive.
+func (i *Inbox) SetExtraHeaders(headers []string) {
+	i.extraHeaders = make([]string, 0, len(headers))
+	for _, h := range headers {
+		if h = strings.TrimSpace(h); h != "" {
+			i.extraHeaders = append(i.extraHeaders, textproto.CanonicalMIMEHeaderKey(h))
 		}
 	}
+}
 
-	return msg, nil
+// pickHeaders returns the values of the headers with the canonical names in names. If a header occurs more than
+// once the first value is used. It returns nil if names is empty.
+func pickHeaders(headers []*gmail.MessagePartHeader, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, h := range names {
+		wanted[h] = true
+	}
+	values := make(map[string]string, len(names))
+	for _, header := range headers {
+		name := textproto.CanonicalMIMEHeaderKey(header.Name)
+		if _, ok := values[name]; wanted[name] && !ok {
+			values[name] = header.Value
+		}
+	}
+	return values
 }
 
-func (i *Inbox) Search(ctx context.Context, query string, maxResults int64, pageToken string) ([]*EmailInfo, error) {
+// fetchInfos fetches the metadata of the messages concurrently using up to fetchWorkers requests at a time.
+// The results are in the same order as ids. Messages that can't be fetched are logged and omitted. extraHeaders
+// are canonical header names to fetch in addition to the ones set with SetExtraHeaders.
+func (i *Inbox) fetchInfos(ctx context.Context, ids []string, extraHeaders ...string) []*EmailInfo {
 	log := util.LoggerFromContext(ctx)
-	// Replace "path/to/your/credentials.json" with the path to your downloaded client configuration file
-	user := "me" // Special value to indicate the authenticated user
-	searchRequest := i.svc.Users.Messages.List(user).Q(query).MaxResults(maxResults)
-	if pageToken != "" {
-		searchRequest.PageToken(pageToken)
+	extraHeaders = append(append([]string{}, i.extraHeaders...), extraHeaders...)
+
+	// Each call writes to its own index so no locking is needed.
+	results := make([]*EmailInfo, len(ids))
+	parallel(len(ids), i.fetchWorkers, func(n int) {
+		info, err := i.getInfo(ctx, ids[n], extraHeaders)
+		if err != nil {
+			log.Error(err, "Error retrieving message", "messageId", ids[n])
+			return
+		}
+		results[n] = info
+	})
+
+	infos := make([]*EmailInfo, 0, len(ids))
+	for _, info := range results {
+		if info != nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// parallel calls fn for every index in [0, n) using up to workers goroutines. It returns once all calls are done.
+func parallel(n int, workers int, fn func(n int)) {
+	workers = max(1, min(workers, n))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				fn(idx)
+			}
+		}()
 	}
-	response, err := searchRequest.Do()
+
+	for idx := 0; idx < n; idx++ {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// infoHeaders are the headers fetched for EmailInfo.
+var infoHeaders = []string{"From", "To", "Cc", "Bcc", "Reply-To", "Subject", "Date", "Message-Id", "In-Reply-To", "List-Id"}
+
+// getInfo fetches the metadata of a message along with the extra headers.
+func (i *Inbox) getInfo(ctx context.Context, messageID string, extraHeaders []string) (*EmailInfo, error) {
+	headers := append(append([]string{}, infoHeaders...), extraHeaders...)
+	var fullMsg *gmail.Message
+	err := retry(ctx, func() error {
+		var err error
+		fullMsg, err = i.svc.Users.Messages.Get(authUser, messageID).Format("metadata").MetadataHeaders(headers...).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to search Gmail: %v", err)
+		return nil, errors.Wrapf(err, "Error retrieving message with id %s", messageID)
 	}
 
-	// Get the full message for each message
-	// The search request only returns the id and threadId
-	emailInfos := make([]*EmailInfo, 0, len(response.Messages))
-	for _, msg := range response.Messages {
-		fullMsg, err := i.svc.Users.Messages.Get(user, msg.Id).Format("metadata").MetadataHeaders("From", "To", "Subject", "Date").Do()
-		if err != nil {
-			log.Error(err, "Error retrieving message", "messageId", msg.Id, "messageThreadId", msg.ThreadId)
-			continue
+	info := &EmailInfo{
+		ID:       fullMsg.Id,
+		ThreadID: fullMsg.ThreadId,
+		Snippet:  fullMsg.Snippet,
+		Date:     parseEpochMillis(fullMsg.InternalDate).Local(),
+		Size:     fullMsg.SizeEstimate,
+		Labels:   i.labelNames(ctx, fullMsg.LabelIds),
+		LabelIDs: fullMsg.LabelIds,
+	}
+	if fullMsg.Payload == nil {
+		return info, nil
+	}
 
+	for _, header := range fullMsg.Payload.Headers {
+		// Header names are case insensitive; e.g. Message-ID vs. Message-Id.
+		switch textproto.CanonicalMIMEHeaderKey(header.Name) {
+		case "From":
+			info.From = header.Value
+		case "To":
+			info.To = header.Value
+		case "Cc":
+			info.Cc = header.Value
+		case "Bcc":
+			info.Bcc = header.Value
+		case "Reply-To":
+			info.ReplyTo = header.Value
+		case "Subject":
+			info.Subject = header.Value
+		case "Date":
+			info.HeaderDate = parseHeaderDate(header.Value)
+		case "Message-Id":
+			info.MessageID = header.Value
+		case "In-Reply-To":
+			info.InReplyTo = header.Value
+		case "List-Id":
+			info.ListID = header.Value
 		}
+	}
+	info.Headers = pickHeaders(fullMsg.Payload.Headers, extraHeaders)
+	info.parseAddresses()
+	return info, nil
+}
 
-		info := &EmailInfo{
-			ID:      fullMsg.Id,
-			Snippet: fullMsg.Snippet,
-			Date:    parseEpochMillis(fullMsg.InternalDate).Local(),
-		}
+// parseAddresses sets the parsed address fields from the raw headers.
+func (e *EmailInfo) parseAddresses() {
+	e.FromAddresses = ParseAddresses(e.From)
+	e.ToAddresses = ParseAddresses(e.To)
+	e.CcAddresses = ParseAddresses(e.Cc)
+	e.BccAddresses = ParseAddresses(e.Bcc)
+	e.ReplyToAddresses = ParseAddresses(e.ReplyTo)
+}
 
-		for _, header := range fullMsg.Payload.Headers {
-			switch header.Name {
-			case "From":
-				info.From = header.Value
-			case "To":
-				info.To = header.Value
-			case "Subject":
-				info.Subject = header.Value
-			}
+// parseAddresses sets the parsed address fields from the raw headers.
+func (e *Email) parseAddresses() {
+	e.FromAddresses = ParseAddresses(e.From)
+	e.ToAddresses = ParseAddresses(e.To)
+	e.CcAddresses = ParseAddresses(e.Cc)
+	e.BccAddresses = ParseAddresses(e.Bcc)
+	e.ReplyToAddresses = ParseAddresses(e.ReplyTo)
+}
+
+// parseHeaderDate parses the value of a Date header. It returns the zero time if the value isn't a valid RFC 5322
+// date since senders don't always set it correctly.
+func parseHeaderDate(value string) time.Time {
+	t, err := mail.ParseDate(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// newEmail converts a message fetched in the "full" format into an Email.
+func newEmail(fullMsg *gmail.Message) (*Email, error) {
+	msg := &Email{
+		ID:       fullMsg.Id,
+		ThreadID: fullMsg.ThreadId,
+		Date:     parseEpochMillis(fullMsg.InternalDate).Local(),
+		Size:     fullMsg.SizeEstimate,
+		LabelIDs: fullMsg.LabelIds,
+	}
+	if fullMsg.Payload == nil {
+		// Responses to mutations (e.g. creating a draft) only include the ids.
+		return msg, nil
+	}
+	for _, header := range fullMsg.Payload.Headers {
+		// Header names are case insensitive and senders aren't consistent; e.g. Message-ID vs. Message-Id.
+		switch textproto.CanonicalMIMEHeaderKey(header.Name) {
+		case "From":
+			msg.From = header.Value
+		case "To":
+			msg.To = header.Value
+		case "Cc":
+			msg.Cc = header.Value
+		case "Bcc":
+			msg.Bcc = header.Value
+		case "Reply-To":
+			msg.ReplyTo = header.Value
+		case "Subject":
+			msg.Subject = header.Value
+		case "Message-Id":
+			msg.MessageID = header.Value
+		case "In-Reply-To":
+			msg.InReplyTo = header.Value
+		case "References":
+			msg.References = header.Value
+		case "List-Id":
+			msg.ListID = header.Value
+		case "Date":
+			msg.HeaderDate = parseHeaderDate(header.Value)
 		}
-		emailInfos = append(emailInfos, info)
 	}
+	msg.parseAddresses()
 
-	return emailInfos, nil
+	// Bodies can be nested arbitrarily deep (e.g. multipart/mixed > multipart/related > multipart/alternative) so
+	// we walk the whole tree.
+	// https://developers.google.com/gmail/api/reference/rest/v1/users.messages#Message.MessagePart
+	b := &bodies{}
+	payload, err := newMessagePart(fullMsg.Payload, b)
+	msg.Payload = payload
+	msg.TextBody = b.text.String()
+	msg.HTMLBody = b.html.String()
+	msg.Body = msg.TextBody
+	if msg.Body == "" {
+		msg.Body = msg.HTMLBody
+	}
+	if err != nil {
+		return msg, err
+	}
+
+	return msg, nil
 }
 
 // parseEpochMillis converts an epoch time in milliseconds to a time.Time
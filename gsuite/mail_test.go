@@ -2,8 +2,15 @@ package gsuite
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
 )
 
 func Test_Search(t *testing.T) {
@@ -25,9 +32,161 @@ func Test_Search(t *testing.T) {
 		t.Fatalf("Error creating inbox: %v", err)
 	}
 
-	results, err := inbox.Search(context.Background(), "from:me", 10, "")
+	results, _, err := inbox.Search(context.Background(), "from:me", 10, "")
 	if err != nil {
 		t.Fatalf("Error searching inbox: %v", err)
 	}
 	t.Logf("Found %d messages", len(results))
 }
+
+func Test_SearchPreservesOrder(t *testing.T) {
+	fake := &fakeMessages{
+		t:     t,
+		count: 50,
+		fail:  map[string]bool{"m7": true},
+	}
+	inbox := newFakeInbox(t, fake)
+	inbox.SetFetchWorkers(8)
+
+	results, _, err := inbox.Search(context.Background(), "", 50, "")
+	if err != nil {
+		t.Fatalf("Error searching inbox: %v", err)
+	}
+
+	if len(results) != 49 {
+		t.Fatalf("Expected 49 results; got %d", len(results))
+	}
+	expected := 0
+	for _, r := range results {
+		if expected == 7 {
+			expected++
+		}
+		if r.ID != fmt.Sprintf("m%d", expected) {
+			t.Fatalf("Results are out of order; expected m%d got %s", expected, r.ID)
+		}
+		expected++
+	}
+}
+
+// BenchmarkSearch compares fetching search results sequentially and concurrently from a fake server with
+// latency similar to gmail's.
+func BenchmarkSearch(b *testing.B) {
+	for _, workers := range []int{1, 10} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			fake := &fakeMessages{
+				t:       b,
+				count:   100,
+				latency: 5 * time.Millisecond,
+			}
+			inbox := newFakeInbox(b, fake)
+			inbox.SetFetchWorkers(workers)
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, _, err := inbox.Search(context.Background(), "", 100, ""); err != nil {
+					b.Fatalf("Error searching inbox: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_SearchPagination(t *testing.T) {
+	fake := &fakeMessages{t: t, count: 10, pageSize: 3}
+	inbox := newFakeInbox(t, fake)
+	ctx := context.Background()
+
+	first, token, err := inbox.Search(ctx, "", 5, "")
+	if err != nil {
+		t.Fatalf("Error searching inbox: %v", err)
+	}
+	if len(first) != 5 || token == "" {
+		t.Fatalf("Expected 5 results and a page token; got %d results and token %q", len(first), token)
+	}
+
+	second, token, err := inbox.Search(ctx, "", 5, token)
+	if err != nil {
+		t.Fatalf("Error searching inbox: %v", err)
+	}
+	if len(second) != 5 || token != "" {
+		t.Fatalf("Expected 5 results and no page token; got %d results and token %q", len(second), token)
+	}
+	if second[0].ID != "m5" {
+		t.Errorf("Expected the second page to resume at m5; got %s", second[0].ID)
+	}
+
+	all, _, err := inbox.Search(ctx, "", 0, "")
+	if err != nil {
+		t.Fatalf("Error searching inbox: %v", err)
+	}
+	if len(all) != 10 {
+		t.Errorf("Expected all 10 results; got %d", len(all))
+	}
+}
+
+func Test_getInfoHeaders(t *testing.T) {
+	var requested []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Query()["metadataHeaders"]
+		msg := &gmail.Message{
+			Id:           "m1",
+			ThreadId:     "t1",
+			SizeEstimate: 1234,
+			LabelIds:     []string{"INBOX"},
+			Payload: &gmail.MessagePart{
+				Headers: []*gmail.MessagePartHeader{
+					{Name: "From", Value: "alice@example.com"},
+					{Name: "CC", Value: "bob@example.com"},
+					{Name: "Reply-To", Value: "list@example.com"},
+					{Name: "Date", Value: "Mon, 2 Jan 2006 15:04:05 -0700 (MST)"},
+					{Name: "Message-ID", Value: "<a@example.com>"},
+					{Name: "In-Reply-To", Value: "<b@example.com>"},
+					{Name: "List-ID", Value: "Announce <announce.example.com>"},
+					{Name: "x-mailer", Value: "mutt"},
+					{Name: "X-Mailer", Value: "second"},
+				},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(msg); err != nil {
+			t.Errorf("Error encoding response: %v", err)
+		}
+	})
+	inbox := newFakeInbox(t, handler)
+	// Cache the labels since the handler only serves the message.
+	inbox.labels = []*Label{{ID: "INBOX", Name: "INBOX"}}
+	inbox.SetExtraHeaders([]string{"x-mailer", " "})
+
+	info, err := inbox.getInfo(context.Background(), "m1", inbox.extraHeaders)
+	if err != nil {
+		t.Fatalf("Error getting message: %v", err)
+	}
+	if requested[len(requested)-1] != "X-Mailer" || len(requested) != len(infoHeaders)+1 {
+		t.Errorf("Unexpected metadata headers %v", requested)
+	}
+	expected := &EmailInfo{
+		ID:               "m1",
+		ThreadID:         "t1",
+		From:             "alice@example.com",
+		Cc:               "bob@example.com",
+		ReplyTo:          "list@example.com",
+		FromAddresses:    []*Address{{Address: "alice@example.com"}},
+		CcAddresses:      []*Address{{Address: "bob@example.com"}},
+		ReplyToAddresses: []*Address{{Address: "list@example.com"}},
+		MessageID:        "<a@example.com>",
+		InReplyTo:        "<b@example.com>",
+		ListID:           "Announce <announce.example.com>",
+		Date:             info.Date,
+		HeaderDate:       time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("", -7*60*60)),
+		Size:             1234,
+		Labels:           []string{"INBOX"},
+		LabelIDs:         []string{"INBOX"},
+		Headers:          map[string]string{"X-Mailer": "mutt"},
+	}
+	if !info.HeaderDate.Equal(expected.HeaderDate) {
+		t.Errorf("Got header date %v; want %v", info.HeaderDate, expected.HeaderDate)
+	}
+	info.HeaderDate = expected.HeaderDate
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Got\n%+v\nwant\n%+v", info, expected)
+	}
+}
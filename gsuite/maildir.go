@@ -0,0 +1,552 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	// syncStateFile is the file in the Maildir where the sync checkpoint is stored.
+	syncStateFile = ".gctl-sync.json"
+
+	// archiveFolder holds messages that don't have any label that maps to a folder; e.g. archived messages.
+	archiveFolder = ".Archive"
+)
+
+// systemFolders maps system labels to Maildir folders. INBOX is the top level Maildir. TRASH and SPAM aren't
+// synced; messages that get those labels are removed from the Maildir.
+var systemFolders = map[string]string{
+	inboxLabel: "",
+	"SENT":     ".Sent",
+	"DRAFT":    ".Drafts",
+}
+
+// SyncResult summarizes a sync.
+type SyncResult struct {
+	// Full is true if all messages were listed rather than using the history since the last sync.
+	Full    bool
+	Added   int
+	Updated int
+	Deleted int
+	// HistoryID is the checkpoint the next sync starts from.
+	HistoryID uint64
+}
+
+// syncState is the checkpoint persisted between syncs.
+type syncState struct {
+	// HistoryID is the gmail history id the Maildir is up to date with. It is 0 until the first full sync completes.
+	HistoryID uint64 `json:"historyId"`
+	// Messages are the synced messages keyed by gmail message id.
+	Messages map[string]*syncedMessage `json:"messages"`
+	// Labels maps label ids to their names as of the last sync so renamed labels can be detected.
+	Labels map[string]string `json:"labels"`
+}
+
+// syncedMessage records where a message is in the Maildir.
+type syncedMessage struct {
+	// Unique is the unique part of the Maildir file names of the message.
+	Unique   string   `json:"unique"`
+	LabelIDs []string `json:"labelIds"`
+	// Folders are the folders the message was written to. They are where the message is looked for when it changes
+	// since the labels it was filed under may have been renamed or deleted since.
+	Folders []string `json:"folders"`
+}
+
+// SyncMaildir downloads the mailbox into the Maildir at dir. The first sync downloads every message; subsequent
+// syncs use the gmail history to only download new messages and apply deletions and label changes.
+//
+// Labels map to Maildir++ folders; INBOX is the top level Maildir, nested labels like Work/Projects become
+// .Work.Projects and messages without any folder label are in .Archive. A message with several labels is stored in
+// each of the corresponding folders. Read and starred map to the S and F flags.
+// The sync is one way; changes made in the Maildir aren't applied to gmail.
+func (i *Inbox) SyncMaildir(ctx context.Context, dir string) (*SyncResult, error) {
+	s := &maildirSyncer{inbox: i, dir: dir}
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	// Labels may have been renamed or deleted since they were cached.
+	i.resetLabels()
+	labels, err := i.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.labelNames = make(map[string]string, len(labels))
+	for _, l := range labels {
+		s.labelNames[l.ID] = l.Name
+	}
+	if err := s.renameFolders(); err != nil {
+		return nil, err
+	}
+
+	if s.state.HistoryID != 0 {
+		result, err := s.incrementalSync(ctx)
+		if err == nil || err != ErrHistoryExpired {
+			return result, err
+		}
+		util.LoggerFromContext(ctx).Info("Gmail history has expired; doing a full sync", "historyId", s.state.HistoryID)
+	}
+	return s.fullSync(ctx)
+}
+
+// maildirSyncer syncs messages to a Maildir.
+type maildirSyncer struct {
+	inbox      *Inbox
+	dir        string
+	state      *syncState
+	labelNames map[string]string
+	// stale are the ids of messages in folders of labels that were deleted since the last sync.
+	stale []string
+}
+
+func (s *maildirSyncer) statePath() string {
+	return filepath.Join(s.dir, syncStateFile)
+}
+
+func (s *maildirSyncer) loadState() error {
+	s.state = &syncState{Messages: map[string]*syncedMessage{}}
+	b, err := os.ReadFile(s.statePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read sync state %s", s.statePath())
+	}
+	if err := json.Unmarshal(b, s.state); err != nil {
+		return errors.Wrapf(err, "Failed to parse sync state %s", s.statePath())
+	}
+	if s.state.Messages == nil {
+		s.state.Messages = map[string]*syncedMessage{}
+	}
+	return nil
+}
+
+// renameFolders moves the folders of labels that were renamed since the last sync. Gmail doesn't record renames
+// in the history so they are detected by comparing the label names with the ones saved in the state. Messages in
+// the folders of labels that were deleted are recorded in stale so their labels are refreshed.
+func (s *maildirSyncer) renameFolders() error {
+	renamed := map[string]string{}
+	deleted := map[string]bool{}
+	for id, oldName := range s.state.Labels {
+		if !strings.HasPrefix(id, "Label_") {
+			// System labels can't be renamed or deleted.
+			continue
+		}
+		oldFolder := maildirFolderName(oldName)
+		newName, ok := s.labelNames[id]
+		if !ok {
+			deleted[oldFolder] = true
+			continue
+		}
+		newFolder := maildirFolderName(newName)
+		if newFolder == oldFolder {
+			continue
+		}
+		if err := moveMaildirFolder(filepath.Join(s.dir, oldFolder), filepath.Join(s.dir, newFolder)); err != nil {
+			return err
+		}
+		renamed[oldFolder] = newFolder
+	}
+
+	for id, synced := range s.state.Messages {
+		changed := false
+		for n, folder := range synced.Folders {
+			if newFolder, ok := renamed[folder]; ok {
+				synced.Folders[n] = newFolder
+				changed = true
+			}
+			if deleted[folder] {
+				s.stale = append(s.stale, id)
+			}
+		}
+		if changed {
+			sort.Strings(synced.Folders)
+		}
+	}
+
+	s.state.Labels = s.labelNames
+	if len(renamed) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	return s.saveState()
+}
+
+func (s *maildirSyncer) saveState() error {
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal sync state")
+	}
+	return writeFileAtomic(s.statePath(), b)
+}
+
+// fullSync lists every message and reconciles the Maildir with it. Messages already in the Maildir aren't
+// downloaded again; only their labels are refreshed.
+func (s *maildirSyncer) fullSync(ctx context.Context) (*SyncResult, error) {
+	log := util.LoggerFromContext(ctx)
+	// Get the history id before listing so that changes made while we are listing are picked up by the next sync.
+	historyID, err := s.inbox.HistoryID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, _, err := s.inbox.listMessageIDs(ctx, "", 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Starting full sync", "dir", s.dir, "messages", len(ids), "alreadySynced", len(s.state.Messages))
+
+	result := &SyncResult{Full: true}
+	current := make(map[string]bool, len(ids))
+	var newIDs, existingIDs []string
+	for _, id := range ids {
+		current[id] = true
+		if _, ok := s.state.Messages[id]; ok {
+			existingIDs = append(existingIDs, id)
+		} else {
+			newIDs = append(newIDs, id)
+		}
+	}
+
+	for id := range s.state.Messages {
+		if !current[id] {
+			if err := s.remove(id); err != nil {
+				return result, err
+			}
+			result.Deleted++
+		}
+	}
+
+	if err := s.download(ctx, newIDs, result); err != nil {
+		return result, err
+	}
+	if err := s.refreshLabels(ctx, existingIDs, result); err != nil {
+		return result, err
+	}
+
+	s.state.HistoryID = historyID
+	result.HistoryID = historyID
+	return result, s.saveState()
+}
+
+// incrementalSync applies the changes since the last sync.
+func (s *maildirSyncer) incrementalSync(ctx context.Context) (*SyncResult, error) {
+	changes, err := s.inbox.ListHistory(ctx, s.state.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	for _, id := range changes.Deleted {
+		if _, ok := s.state.Messages[id]; !ok {
+			continue
+		}
+		if err := s.remove(id); err != nil {
+			return result, err
+		}
+		result.Deleted++
+	}
+
+	var newIDs, existingIDs []string
+	seen := map[string]bool{}
+	for _, id := range append(append(changes.Added, changes.LabelsChanged...), s.stale...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, ok := s.state.Messages[id]; ok {
+			existingIDs = append(existingIDs, id)
+		} else {
+			newIDs = append(newIDs, id)
+		}
+	}
+
+	if err := s.download(ctx, newIDs, result); err != nil {
+		return result, err
+	}
+	if err := s.refreshLabels(ctx, existingIDs, result); err != nil {
+		return result, err
+	}
+
+	s.state.HistoryID = changes.HistoryID
+	result.HistoryID = changes.HistoryID
+	return result, s.saveState()
+}
+
+// download fetches the messages and writes them to the Maildir. The state is saved after each batch so an
+// interrupted sync doesn't download them again.
+func (s *maildirSyncer) download(ctx context.Context, ids []string, result *SyncResult) error {
+	for start := 0; start < len(ids); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(ids))
+		msgs, fetchErr := s.inbox.fetchRaw(ctx, ids[start:end])
+		for _, msg := range msgs {
+			unique := fmt.Sprintf("%d.%s.gctl", msg.Date.Unix(), msg.ID)
+			folders := s.folders(msg.LabelIDs)
+			if err := s.place(unique, msg.Data, nil, folders, maildirFlags(msg.LabelIDs)); err != nil {
+				return err
+			}
+			if len(folders) > 0 {
+				s.state.Messages[msg.ID] = &syncedMessage{Unique: unique, LabelIDs: msg.LabelIDs, Folders: folders}
+				result.Added++
+			}
+		}
+		if err := s.saveState(); err != nil {
+			return err
+		}
+		if fetchErr != nil {
+			return fetchErr
+		}
+	}
+	return nil
+}
+
+// refreshLabels fetches the current labels of messages that are already in the Maildir and moves them to the
+// matching folders and flags.
+func (s *maildirSyncer) refreshLabels(ctx context.Context, ids []string, result *SyncResult) error {
+	type labelResult struct {
+		labelIDs []string
+		exists   bool
+		err      error
+	}
+	results := make([]labelResult, len(ids))
+	parallel(len(ids), s.inbox.fetchWorkers, func(n int) {
+		r := &results[n]
+		r.labelIDs, r.exists, r.err = s.inbox.getLabelIDs(ctx, ids[n])
+	})
+
+	for n, id := range ids {
+		r := results[n]
+		if r.err != nil {
+			return r.err
+		}
+		synced := s.state.Messages[id]
+		folders := s.folders(r.labelIDs)
+		if !r.exists || len(folders) == 0 {
+			if err := s.remove(id); err != nil {
+				return err
+			}
+			result.Deleted++
+			continue
+		}
+		if sameStrings(synced.LabelIDs, r.labelIDs) && sameStrings(synced.Folders, folders) {
+			continue
+		}
+		if err := s.place(synced.Unique, nil, synced.Folders, folders, maildirFlags(r.labelIDs)); err != nil {
+			return err
+		}
+		synced.LabelIDs = r.labelIDs
+		synced.Folders = folders
+		result.Updated++
+	}
+	return nil
+}
+
+// remove deletes the message from every folder it is in.
+func (s *maildirSyncer) remove(id string) error {
+	synced := s.state.Messages[id]
+	if err := s.place(synced.Unique, nil, synced.Folders, nil, ""); err != nil {
+		return err
+	}
+	delete(s.state.Messages, id)
+	return nil
+}
+
+// place moves the message from the folders it was in to the folders it should be in with the given flags. data is
+// the message; if it is nil it is copied from one of the message's existing files.
+func (s *maildirSyncer) place(unique string, data []byte, from []string, to []string, flags string) error {
+	existing := map[string]string{}
+	for _, folder := range from {
+		if path := findMaildirFile(filepath.Join(s.dir, folder), unique); path != "" {
+			existing[folder] = path
+		}
+	}
+
+	name := unique + ":2," + flags
+	for _, folder := range to {
+		folderDir := filepath.Join(s.dir, folder)
+		target := filepath.Join(folderDir, "cur", name)
+		if path, ok := existing[folder]; ok {
+			delete(existing, folder)
+			if path != target {
+				if err := os.Rename(path, target); err != nil {
+					return errors.Wrapf(err, "Failed to rename %s to %s", path, target)
+				}
+			}
+			continue
+		}
+
+		if data == nil {
+			for _, path := range existing {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to read %s", path)
+				}
+				data = b
+				break
+			}
+		}
+		if data == nil {
+			return errors.Errorf("No local copy of message %s to add to folder %q", unique, folder)
+		}
+		if err := deliverMaildir(folderDir, name, data); err != nil {
+			return err
+		}
+	}
+
+	// Anything left is in a folder the message is no longer in.
+	for _, path := range existing {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Failed to remove %s", path)
+		}
+	}
+	return nil
+}
+
+// folders returns the Maildir folders, relative to the top level Maildir, a message with the labels belongs in.
+// It returns nil if the message shouldn't be synced.
+func (s *maildirSyncer) folders(labelIDs []string) []string {
+	folders := make([]string, 0, len(labelIDs))
+	for _, id := range labelIDs {
+		if id == trashLabel || id == spamLabel {
+			return nil
+		}
+		if folder, ok := systemFolders[id]; ok {
+			folders = append(folders, folder)
+			continue
+		}
+		name, ok := s.labelNames[id]
+		if !ok || !strings.HasPrefix(id, "Label_") {
+			// Other system labels like UNREAD and CATEGORY_* are flags or categories rather than folders.
+			continue
+		}
+		folders = append(folders, maildirFolderName(name))
+	}
+	if len(folders) == 0 {
+		folders = append(folders, archiveFolder)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// maildirFolderName converts a label name to a Maildir++ folder; e.g. Work/Projects becomes .Work.Projects.
+// Maildir++ uses "." as the hierarchy separator so dots in the name are replaced.
+func maildirFolderName(label string) string {
+	pieces := strings.Split(label, labelSeparator)
+	for n, p := range pieces {
+		pieces[n] = strings.ReplaceAll(p, ".", "_")
+	}
+	return "." + strings.Join(pieces, ".")
+}
+
+// maildirFlags returns the Maildir info flags for the labels in the alphabetical order the spec requires.
+// https://cr.yp.to/proto/maildir.html
+func maildirFlags(labelIDs []string) string {
+	seen := true
+	flags := make([]string, 0, 3)
+	for _, id := range labelIDs {
+		switch id {
+		case unreadLabel:
+			seen = false
+		case starredLabel:
+			flags = append(flags, "F")
+		case "DRAFT":
+			flags = append(flags, "D")
+		}
+	}
+	if seen {
+		flags = append(flags, "S")
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, "")
+}
+
+// moveMaildirFolder moves the messages in the folder from to the folder to. If to doesn't exist the folder is
+// renamed; otherwise the messages are moved into it.
+func moveMaildirFolder(from string, to string) error {
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(to); os.IsNotExist(err) {
+		if err := os.Rename(from, to); err != nil {
+			return errors.Wrapf(err, "Failed to rename %s to %s", from, to)
+		}
+		return nil
+	}
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(from, sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list %s", filepath.Join(from, sub))
+		}
+		if err := os.MkdirAll(filepath.Join(to, sub), 0o700); err != nil {
+			return errors.Wrapf(err, "Failed to create Maildir %s", to)
+		}
+		for _, e := range entries {
+			src, dest := filepath.Join(from, sub, e.Name()), filepath.Join(to, sub, e.Name())
+			if err := os.Rename(src, dest); err != nil {
+				return errors.Wrapf(err, "Failed to rename %s to %s", src, dest)
+			}
+		}
+	}
+	if err := os.RemoveAll(from); err != nil {
+		return errors.Wrapf(err, "Failed to remove %s", from)
+	}
+	return nil
+}
+
+// findMaildirFile returns the path of the message in the folder or the empty string if it isn't there. Mail
+// clients change the flags in the file name so we look the file up by its unique name.
+func findMaildirFile(folderDir string, unique string) string {
+	for _, sub := range []string{"cur", "new"} {
+		matches, err := filepath.Glob(filepath.Join(folderDir, sub, unique+"*"))
+		if err == nil && len(matches) > 0 {
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+// deliverMaildir writes the message to tmp and then moves it to cur as the Maildir spec requires so readers never
+// see partially written messages.
+func deliverMaildir(folderDir string, name string, data []byte) error {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(folderDir, sub), 0o700); err != nil {
+			return errors.Wrapf(err, "Failed to create Maildir %s", folderDir)
+		}
+	}
+	tmp := filepath.Join(folderDir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return errors.Wrapf(err, "Failed to write %s", tmp)
+	}
+	target := filepath.Join(folderDir, "cur", name)
+	if err := os.Rename(tmp, target); err != nil {
+		return errors.Wrapf(err, "Failed to move %s to %s", tmp, target)
+	}
+	return nil
+}
+
+// sameStrings returns true if a and b contain the same strings ignoring order.
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+		if counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
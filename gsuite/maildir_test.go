@@ -0,0 +1,300 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeMailbox is a fake of the parts of the gmail API used by the Maildir sync. messages maps message ids to
+// their label ids.
+type fakeMailbox struct {
+	t         testing.TB
+	mu        sync.Mutex
+	messages  map[string][]string
+	historyID uint64
+	// history is returned by history.list when the start id is historyStart.
+	history      []*gmail.History
+	historyStart uint64
+	// expired makes history.list return a 404.
+	expired bool
+	// matching are the ids returned when messages.list is called with a query. queries records the queries.
+	matching []string
+	queries  []string
+	// fail are the ids of messages for which fetching fails.
+	fail map[string]bool
+	// labels are the mailbox's labels. If it is nil a default set of labels is used.
+	labels []*gmail.Label
+}
+
+func (f *fakeMailbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	const prefix = "/gmail/v1/users/me"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	var resp interface{}
+	switch {
+	case path == "/profile":
+		resp = &gmail.Profile{HistoryId: f.historyID}
+	case path == "/labels":
+		labels := f.labels
+		if labels == nil {
+			labels = []*gmail.Label{
+				{Id: "INBOX", Name: "INBOX", Type: "system"},
+				{Id: "UNREAD", Name: "UNREAD", Type: "system"},
+				{Id: "STARRED", Name: "STARRED", Type: "system"},
+				{Id: "Label_1", Name: "Work/Projects", Type: "user"},
+				{Id: "Label_2", Name: "v1.2", Type: "user"},
+			}
+		}
+		resp = &gmail.ListLabelsResponse{Labels: labels}
+	case path == "/history":
+		start, _ := strconv.ParseUint(r.URL.Query().Get("startHistoryId"), 10, 64)
+		if f.expired || start != f.historyStart {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		resp = &gmail.ListHistoryResponse{History: f.history, HistoryId: f.historyID}
+	case path == "/messages":
+		list := &gmail.ListMessagesResponse{}
+		ids := f.matching
+		if q := r.URL.Query().Get("q"); q == "" {
+			ids = make([]string, 0, len(f.messages))
+			for id := range f.messages {
+				ids = append(ids, id)
+			}
+		} else {
+			f.queries = append(f.queries, q)
+		}
+		for _, id := range ids {
+			list.Messages = append(list.Messages, &gmail.Message{Id: id})
+		}
+		sort.Slice(list.Messages, func(a, b int) bool { return list.Messages[a].Id < list.Messages[b].Id })
+		resp = list
+	default:
+		id := strings.TrimPrefix(path, "/messages/")
+		if f.fail[id] {
+			http.Error(w, `{"error": {"code": 403, "message": "forbidden"}}`, http.StatusForbidden)
+			return
+		}
+		labels, ok := f.messages[id]
+		if !ok {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		msg := &gmail.Message{Id: id, ThreadId: "t" + id, LabelIds: labels, InternalDate: 1700000000000}
+		switch r.URL.Query().Get("format") {
+		case "raw":
+			msg.Raw = encodeData(fakeRawMessage(id))
+		case "metadata":
+			msg.Payload = &gmail.MessagePart{
+				Headers: []*gmail.MessagePartHeader{
+					{Name: "Subject", Value: "Subject of " + id},
+					{Name: "Message-Id", Value: "<" + id + "@example.com>"},
+				},
+			}
+		}
+		resp = msg
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+// listMaildir returns the paths of the message files in the Maildir relative to dir.
+func listMaildir(t *testing.T, dir string) []string {
+	t.Helper()
+	files := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() == syncStateFile {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Error listing Maildir: %v", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func Test_SyncMaildir(t *testing.T) {
+	dir := t.TempDir()
+	f := &fakeMailbox{
+		t: t,
+		messages: map[string][]string{
+			"m0": {"INBOX", "UNREAD"},
+			"m1": {"INBOX", "Label_1", "STARRED"},
+			"m2": {},
+			"m3": {"Label_2"},
+		},
+		historyID: 100,
+	}
+	inbox := newFakeInbox(t, f)
+	inbox.SetFetchWorkers(2)
+
+	result, err := inbox.SyncMaildir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if expected := (&SyncResult{Full: true, Added: 4, HistoryID: 100}); !reflect.DeepEqual(expected, result) {
+		t.Errorf("Unexpected full sync result; got %+v want %+v", result, expected)
+	}
+	expected := []string{
+		".Archive/cur/1700000000.m2.gctl:2,S",
+		".Work.Projects/cur/1700000000.m1.gctl:2,FS",
+		".v1_2/cur/1700000000.m3.gctl:2,S",
+		"cur/1700000000.m0.gctl:2,",
+		"cur/1700000000.m1.gctl:2,FS",
+	}
+	if actual := listMaildir(t, dir); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected Maildir after full sync:\ngot  %v\nwant %v", actual, expected)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "cur", "1700000000.m0.gctl:2,"))
+	if err != nil {
+		t.Fatalf("Error reading message: %v", err)
+	}
+	if string(b) != fakeRawMessage("m0") {
+		t.Errorf("Unexpected message contents: %q", string(b))
+	}
+
+	// m0 is read and archived, m1 is deleted and m4 is new.
+	f.mu.Lock()
+	f.messages["m0"] = []string{}
+	delete(f.messages, "m1")
+	f.messages["m4"] = []string{"INBOX"}
+	f.historyStart = 100
+	f.historyID = 105
+	f.history = []*gmail.History{
+		{LabelsRemoved: []*gmail.HistoryLabelRemoved{{Message: &gmail.Message{Id: "m0"}}}},
+		{MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: "m1"}}}},
+		{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "m4"}}}},
+	}
+	f.mu.Unlock()
+
+	result, err = inbox.SyncMaildir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if expected := (&SyncResult{Added: 1, Updated: 1, Deleted: 1, HistoryID: 105}); !reflect.DeepEqual(expected, result) {
+		t.Errorf("Unexpected incremental sync result; got %+v want %+v", result, expected)
+	}
+	expected = []string{
+		".Archive/cur/1700000000.m0.gctl:2,S",
+		".Archive/cur/1700000000.m2.gctl:2,S",
+		".v1_2/cur/1700000000.m3.gctl:2,S",
+		"cur/1700000000.m4.gctl:2,S",
+	}
+	if actual := listMaildir(t, dir); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected Maildir after incremental sync:\ngot  %v\nwant %v", actual, expected)
+	}
+
+	// When the history has expired a full sync reconciles the Maildir.
+	f.mu.Lock()
+	f.expired = true
+	f.messages["m3"] = []string{"TRASH"}
+	f.mu.Unlock()
+
+	result, err = inbox.SyncMaildir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if expected := (&SyncResult{Full: true, Deleted: 1, HistoryID: 105}); !reflect.DeepEqual(expected, result) {
+		t.Errorf("Unexpected full sync result; got %+v want %+v", result, expected)
+	}
+	expected = []string{
+		".Archive/cur/1700000000.m0.gctl:2,S",
+		".Archive/cur/1700000000.m2.gctl:2,S",
+		"cur/1700000000.m4.gctl:2,S",
+	}
+	if actual := listMaildir(t, dir); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected Maildir after expired history:\ngot  %v\nwant %v", actual, expected)
+	}
+}
+
+func Test_SyncMaildirRenamedLabels(t *testing.T) {
+	dir := t.TempDir()
+	f := &fakeMailbox{
+		t: t,
+		messages: map[string][]string{
+			"m1": {"Label_1"},
+			"m2": {"Label_2"},
+		},
+		labels: []*gmail.Label{
+			{Id: "STARRED", Name: "STARRED", Type: "system"},
+			{Id: "Label_1", Name: "Work/Projects", Type: "user"},
+			{Id: "Label_2", Name: "Receipts", Type: "user"},
+		},
+		historyID: 100,
+	}
+	inbox := newFakeInbox(t, f)
+	if _, err := inbox.SyncMaildir(context.Background(), dir); err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+
+	// Work/Projects is renamed and then m1 is starred. Receipts is deleted which removes it from m2 without a
+	// history event.
+	f.mu.Lock()
+	f.labels = []*gmail.Label{
+		{Id: "STARRED", Name: "STARRED", Type: "system"},
+		{Id: "Label_1", Name: "Work/Done", Type: "user"},
+	}
+	f.messages["m1"] = []string{"Label_1", "STARRED"}
+	f.messages["m2"] = []string{}
+	f.historyStart = 100
+	f.historyID = 105
+	f.history = []*gmail.History{
+		{LabelsAdded: []*gmail.HistoryLabelAdded{{Message: &gmail.Message{Id: "m1"}, LabelIds: []string{"STARRED"}}}},
+	}
+	f.mu.Unlock()
+
+	result, err := inbox.SyncMaildir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Error syncing: %v", err)
+	}
+	if expected := (&SyncResult{Updated: 2, HistoryID: 105}); !reflect.DeepEqual(expected, result) {
+		t.Errorf("Unexpected sync result; got %+v want %+v", result, expected)
+	}
+	expected := []string{
+		".Archive/cur/1700000000.m2.gctl:2,S",
+		".Work.Done/cur/1700000000.m1.gctl:2,FS",
+	}
+	if actual := listMaildir(t, dir); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected Maildir after renaming labels:\ngot  %v\nwant %v", actual, expected)
+	}
+}
+
+func Test_maildirFlags(t *testing.T) {
+	type testCase struct {
+		labels   []string
+		expected string
+	}
+	cases := []testCase{
+		{labels: []string{"INBOX"}, expected: "S"},
+		{labels: []string{"INBOX", "UNREAD"}, expected: ""},
+		{labels: []string{"STARRED", "UNREAD"}, expected: "F"},
+		{labels: []string{"DRAFT", "STARRED"}, expected: "DFS"},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.labels, ","), func(t *testing.T) {
+			if actual := maildirFlags(c.labels); actual != c.expected {
+				t.Errorf("Got %q; want %q", actual, c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package gsuite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// mboxFromPrefix is the prefix of the line separating messages in an mbox file.
+var mboxFromPrefix = []byte("From ")
+
+// writeMboxMessage writes msg to w in mboxrd format. Lines in the message matching ^>*From are quoted by adding a
+// ">" so the message can be recovered exactly when reading the mbox.
+// https://www.loc.gov/preservation/digital/formats/fdd/fdd000385.shtml
+func writeMboxMessage(w io.Writer, date time.Time, msg []byte) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From MAILER-DAEMON %s\n", date.UTC().Format(time.ANSIC))
+
+	for len(msg) > 0 {
+		end := bytes.IndexByte(msg, '\n') + 1
+		if end == 0 {
+			end = len(msg)
+		}
+		line := msg[:end]
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), mboxFromPrefix) {
+			buf.WriteByte('>')
+		}
+		buf.Write(line)
+		msg = msg[end:]
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	// A blank line separates messages.
+	buf.WriteByte('\n')
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// readMbox calls fn with each message in the mbox and the offset of its "From " line. Lines quoted by
+// writeMboxMessage (mboxrd) are unquoted. Messages are split on "From " lines that start the file or follow a blank
+// line so that unquoted "From " lines in mboxo files are only mistaken for separators after a blank line. Content
+// before the first "From " line is an error since the file probably isn't an mbox.
+func readMbox(r io.Reader, fn func(offset int64, msg []byte) error) error {
+	br := bufio.NewReader(r)
+	var msg bytes.Buffer
+	var offset, start int64
+	inMessage := false
+	prevBlank := true
+	flush := func() error {
+		if !inMessage {
+			return nil
+		}
+		// The blank line before the next separator isn't part of the message.
+		data := msg.Bytes()
+		if bytes.HasSuffix(data, []byte("\r\n\r\n")) {
+			data = data[:len(data)-2]
+		} else if bytes.HasSuffix(data, []byte("\n\n")) {
+			data = data[:len(data)-1]
+		}
+		return fn(start, data)
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lineStart := offset
+			offset += int64(len(line))
+			switch {
+			case prevBlank && bytes.HasPrefix(line, mboxFromPrefix):
+				if err := flush(); err != nil {
+					return err
+				}
+				msg.Reset()
+				start = lineStart
+				inMessage = true
+			case inMessage:
+				if trimmed := bytes.TrimLeft(line, ">"); len(trimmed) < len(line) && bytes.HasPrefix(trimmed, mboxFromPrefix) {
+					line = line[1:]
+				}
+				msg.Write(line)
+			case len(bytes.TrimSpace(line)) > 0:
+				return errors.Errorf("Line at offset %d comes before the first \"From \" line; the file isn't an mbox", lineStart)
+			}
+			prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read mbox")
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	// The names of the templates in a mail merge template file.
+	mergeSubjectTemplate = "subject"
+	mergeTextTemplate    = "text"
+	mergeHTMLTemplate    = "html"
+
+	// The columns in the mail merge data with a special meaning. Every column can be used in the templates.
+	mergeIDColumn          = "id"
+	mergeEmailColumn       = "email"
+	mergeCcColumn          = "cc"
+	mergeBccColumn         = "bcc"
+	mergeAttachmentsColumn = "attachments"
+)
+
+// MergeTemplate is the template of the messages in a mail merge. It is a Go template file defining the templates
+// "subject" and at least one of "text" and "html"; e.g.
+//
+//	{{define "subject"}}Welcome {{.name}}{{end}}
+//	{{define "text"}}Hi {{.name}}, ...{{end}}
+//	{{define "html"}}<p>Hi {{.name}}, ...</p>{{end}}
+//
+// The text templates are rendered with text/template and the HTML template with html/template so that values are
+// escaped.
+type MergeTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// ParseMergeTemplate parses a mail merge template. Templates referring to a column that isn't in the data fail to
+// render rather than rendering "<no value>".
+func ParseMergeTemplate(name string, src string) (*MergeTemplate, error) {
+	text, err := texttemplate.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse template %s", name)
+	}
+	html, err := htmltemplate.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse template %s", name)
+	}
+
+	t := &MergeTemplate{
+		subject: text.Lookup(mergeSubjectTemplate),
+		text:    text.Lookup(mergeTextTemplate),
+		html:    html.Lookup(mergeHTMLTemplate),
+	}
+	if t.subject == nil {
+		return nil, errors.Errorf("Template %s doesn't define the %q template", name, mergeSubjectTemplate)
+	}
+	if t.text == nil && t.html == nil {
+		return nil, errors.Errorf("Template %s must define a %q or %q template for the body", name, mergeTextTemplate, mergeHTMLTemplate)
+	}
+	return t, nil
+}
+
+// MergeRow is a row of the mail merge data keyed by column name.
+type MergeRow map[string]string
+
+// ReadMergeData reads the mail merge data from a CSV file. The first row is the column names. Every row must have
+// an email column with the recipients; the optional cc and bcc columns are additional recipients and the optional
+// attachments column is a list of files separated by semicolons. The optional id column identifies rows sending
+// more than one message to the same recipients.
+func ReadMergeData(r io.Reader) ([]MergeRow, error) {
+	cr := csv.NewReader(r)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read CSV")
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV is empty; the first row must be the column names")
+	}
+	header := records[0]
+	for n, name := range header {
+		header[n] = strings.TrimSpace(name)
+	}
+	hasEmail := false
+	for _, name := range header {
+		hasEmail = hasEmail || name == mergeEmailColumn
+	}
+	if !hasEmail {
+		return nil, errors.Errorf("CSV doesn't have an %q column", mergeEmailColumn)
+	}
+
+	rows := make([]MergeRow, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(MergeRow, len(header))
+		for n, name := range header {
+			row[name] = strings.TrimSpace(record[n])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// MergeMessage is the message rendered for a row of the mail merge data.
+type MergeMessage struct {
+	// Row is the number of the row in the data starting at 1.
+	Row int
+	// ID is the value of the row's id column if the data has one.
+	ID      string
+	Message *OutgoingMessage
+}
+
+// key identifies the message in the mail merge log. It is the row's id and recipients rather than the row number or
+// anything rendered from the template so that rows can be added or removed and the template fixed between runs
+// without resending messages.
+func (m *MergeMessage) key() string {
+	recipients := append(append(append([]string{}, m.Message.To...), m.Message.Cc...), m.Message.Bcc...)
+	return m.ID + "\n" + strings.ToLower(strings.Join(recipients, ","))
+}
+
+// Render renders the message for each row. Attachment paths are relative to dir. Every row is rendered before any
+// message is sent so that mistakes in the template or data don't leave a mail merge half sent. Rows with the same
+// id and recipients are an error since the log couldn't tell their messages apart.
+func (t *MergeTemplate) Render(rows []MergeRow, dir string) ([]*MergeMessage, error) {
+	msgs := make([]*MergeMessage, 0, len(rows))
+	// rowKeys maps the key of each message to its row.
+	rowKeys := map[string]int{}
+	for n, row := range rows {
+		m, err := t.renderRow(row, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to render row %d", n+1)
+		}
+		msg := &MergeMessage{Row: n + 1, ID: row[mergeIDColumn], Message: m}
+		if prev, ok := rowKeys[msg.key()]; ok {
+			return nil, errors.Errorf("Rows %d and %d have the same %q and recipients; give them different values in the %q column", prev, msg.Row, mergeIDColumn, mergeIDColumn)
+		}
+		rowKeys[msg.key()] = msg.Row
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (t *MergeTemplate) renderRow(row MergeRow, dir string) (*OutgoingMessage, error) {
+	if row[mergeEmailColumn] == "" {
+		return nil, errors.Errorf("The %q column is empty", mergeEmailColumn)
+	}
+	m := &OutgoingMessage{
+		To:  []string{row[mergeEmailColumn]},
+		Cc:  nonEmpty(row[mergeCcColumn]),
+		Bcc: nonEmpty(row[mergeBccColumn]),
+	}
+
+	var buf bytes.Buffer
+	if err := t.subject.Execute(&buf, row); err != nil {
+		return nil, errors.Wrapf(err, "Failed to render the subject")
+	}
+	// Subjects can't span lines.
+	m.Subject = strings.Join(strings.Fields(buf.String()), " ")
+	if t.text != nil {
+		buf.Reset()
+		if err := t.text.Execute(&buf, row); err != nil {
+			return nil, errors.Wrapf(err, "Failed to render the text body")
+		}
+		m.TextBody = strings.TrimSpace(buf.String()) + "\n"
+	}
+	if t.html != nil {
+		buf.Reset()
+		if err := t.html.Execute(&buf, row); err != nil {
+			return nil, errors.Wrapf(err, "Failed to render the HTML body")
+		}
+		m.HTMLBody = strings.TrimSpace(buf.String()) + "\n"
+	}
+
+	for _, path := range strings.Split(row[mergeAttachmentsColumn], ";") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		a, err := NewAttachmentFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		m.Attachments = append(m.Attachments, a)
+	}
+	return m, nil
+}
+
+// nonEmpty returns a slice containing value or nil if it is empty.
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// WriteMergeEML writes each message to row-<n>.eml in dir so a mail merge can be reviewed before it is sent.
+func WriteMergeEML(msgs []*MergeMessage, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory %s", dir)
+	}
+	for _, m := range msgs {
+		raw, err := m.Message.Build()
+		if err != nil {
+			return errors.Wrapf(err, "Failed to build the message for row %d", m.Row)
+		}
+		if err := writeFileAtomic(filepath.Join(dir, fmt.Sprintf("row-%04d.eml", m.Row)), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeOptions configures sending a mail merge.
+type MergeOptions struct {
+	// From is the send-as alias to send from. If it is empty the default alias is used.
+	From string
+	// Interval is the minimum time between sending messages.
+	Interval time.Duration
+	// Log is the path of the log recording the sent messages.
+	Log string
+}
+
+// MergeResult summarizes sending a mail merge.
+type MergeResult struct {
+	// Sent is the number of messages sent by this run.
+	Sent int
+	// Skipped is the number of messages that had already been sent.
+	Skipped int
+	// Log is the path of the log recording every sent message.
+	Log string
+}
+
+// mergeRecord records a message sent by a mail merge in its log.
+type mergeRecord struct {
+	ID       string    `json:"id"`
+	ThreadID string    `json:"threadId"`
+	Date     time.Time `json:"date"`
+	// Key identifies the message in the mail merge; see MergeMessage.key.
+	Key string `json:"key"`
+}
+
+// mergeLog is the JSON lines file recording the messages sent by a mail merge.
+type mergeLog struct {
+	*jsonlFile
+	sent map[string]bool
+}
+
+// openMergeLog reads the log at path if it exists and opens it for appending.
+func openMergeLog(path string) (*mergeLog, error) {
+	l := &mergeLog{sent: map[string]bool{}}
+	f, err := openJSONL(path, func(line []byte) error {
+		r := &mergeRecord{}
+		if err := decodeJSONLRecord(line, r); err != nil {
+			return err
+		}
+		if r.Key == "" {
+			return errors.New("Record is missing the key; is this a mail merge log?")
+		}
+		l.sent[r.Key] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.jsonlFile = f
+	return l, nil
+}
+
+func (l *mergeLog) add(r *mergeRecord) error {
+	if err := l.append(r); err != nil {
+		return err
+	}
+	l.sent[r.Key] = true
+	return nil
+}
+
+// SendMerge sends the messages of a mail merge. Every sent message is recorded in the log and messages already in
+// it are skipped so a mail merge that failed part way through can be rerun without sending anyone the same message
+// twice.
+func (i *Inbox) SendMerge(ctx context.Context, msgs []*MergeMessage, opts MergeOptions) (*MergeResult, error) {
+	log := util.LoggerFromContext(ctx)
+	if opts.Log == "" {
+		return nil, errors.New("A mail merge requires a log to record the sent messages")
+	}
+	sentLog, err := openMergeLog(opts.Log)
+	if err != nil {
+		return nil, err
+	}
+	defer sentLog.Close()
+
+	result := &MergeResult{Log: sentLog.path}
+	var last time.Time
+	for _, m := range msgs {
+		key := m.key()
+		if sentLog.sent[key] {
+			result.Skipped++
+			continue
+		}
+
+		if wait := opts.Interval - time.Since(last); !last.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		last = time.Now()
+
+		m.Message.From = opts.From
+		msg, err := i.Send(ctx, m.Message)
+		if err != nil {
+			return result, errors.Wrapf(err, "Failed to send the message for row %d to %s", m.Row, strings.Join(m.Message.To, ", "))
+		}
+		if err := sentLog.add(&mergeRecord{ID: msg.Id, ThreadID: msg.ThreadId, Date: last, Key: key}); err != nil {
+			return result, err
+		}
+		result.Sent++
+		log.Info("Sent mail merge message", "row", m.Row, "to", m.Message.To, "sent", result.Sent, "remaining", len(msgs)-result.Sent-result.Skipped)
+	}
+	return result, nil
+}
@@ -0,0 +1,222 @@
+package gsuite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMergeTemplate = `{{define "subject"}}
+  Welcome {{.name}}
+{{end}}
+{{define "text"}}
+Hi {{.name}}, your team is {{.team}}.
+{{end}}
+{{define "html"}}<p>Hi {{.name}}, your team is {{.team}}.</p>{{end}}
+`
+
+const testMergeData = `email,name,team,attachments
+alice@example.com,Alice,R&D,agenda.txt
+bob@example.com,Bob,<Sales>,
+`
+
+func Test_MergeRender(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "agenda.txt"), []byte("9am: coffee"), 0o644); err != nil {
+		t.Fatalf("Error writing attachment: %v", err)
+	}
+	tmpl, err := ParseMergeTemplate("msg.tmpl", testMergeTemplate)
+	if err != nil {
+		t.Fatalf("Error parsing template: %v", err)
+	}
+	rows, err := ReadMergeData(strings.NewReader(testMergeData))
+	if err != nil {
+		t.Fatalf("Error reading data: %v", err)
+	}
+	msgs, err := tmpl.Render(rows, dir)
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages; got %d", len(msgs))
+	}
+
+	alice := msgs[0].Message
+	if alice.Subject != "Welcome Alice" || alice.To[0] != "alice@example.com" {
+		t.Errorf("Unexpected message %+v", alice)
+	}
+	if alice.TextBody != "Hi Alice, your team is R&D.\n" {
+		t.Errorf("Unexpected text body %q", alice.TextBody)
+	}
+	if len(alice.Attachments) != 1 || alice.Attachments[0].Filename != "agenda.txt" {
+		t.Errorf("Expected the row's attachment; got %+v", alice.Attachments)
+	}
+	bob := msgs[1].Message
+	if bob.HTMLBody != "<p>Hi Bob, your team is &lt;Sales&gt;.</p>\n" {
+		t.Errorf("Expected values to be escaped in the HTML body; got %q", bob.HTMLBody)
+	}
+	if len(bob.Attachments) != 0 {
+		t.Errorf("Expected no attachments; got %+v", bob.Attachments)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := WriteMergeEML(msgs, out); err != nil {
+		t.Fatalf("Error writing eml files: %v", err)
+	}
+	eml, err := os.ReadFile(filepath.Join(out, "row-0002.eml"))
+	if err != nil {
+		t.Fatalf("Error reading eml: %v", err)
+	}
+	if !strings.Contains(string(eml), "Subject: Welcome Bob\r\n") {
+		t.Errorf("Unexpected eml\n%s", eml)
+	}
+}
+
+func Test_MergeErrors(t *testing.T) {
+	type testCase struct {
+		name     string
+		template string
+		data     string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:     "no-subject",
+			template: `{{define "text"}}Hi{{end}}`,
+			data:     "email\nalice@example.com\n",
+			expected: `doesn't define the "subject" template`,
+		},
+		{
+			name:     "no-body",
+			template: `{{define "subject"}}Hi{{end}}`,
+			data:     "email\nalice@example.com\n",
+			expected: "for the body",
+		},
+		{
+			name:     "missing-column",
+			template: testMergeTemplate,
+			data:     "email,name\nalice@example.com,Alice\n",
+			expected: "Failed to render row 1",
+		},
+		{
+			name:     "no-email-column",
+			template: testMergeTemplate,
+			data:     "name,team\nAlice,R&D\n",
+			expected: `doesn't have an "email" column`,
+		},
+		{
+			name:     "duplicate-recipient",
+			template: testMergeTemplate,
+			data:     "email,name,team\nalice@example.com,Alice,R&D\nALICE@example.com,Alice,Sales\n",
+			expected: "Rows 1 and 2 have the same",
+		},
+		{
+			name:     "duplicate-id",
+			template: testMergeTemplate,
+			data:     "id,email,name,team\n1,alice@example.com,Alice,R&D\n1,alice@example.com,Alice,Sales\n",
+			expected: "Rows 1 and 2 have the same",
+		},
+		{
+			name:     "missing-attachment",
+			template: testMergeTemplate,
+			data:     "email,name,team,attachments\nalice@example.com,Alice,R&D,missing.pdf\n",
+			expected: "Failed to read attachment",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := func() error {
+				tmpl, err := ParseMergeTemplate("msg.tmpl", c.template)
+				if err != nil {
+					return err
+				}
+				rows, err := ReadMergeData(strings.NewReader(c.data))
+				if err != nil {
+					return err
+				}
+				_, err = tmpl.Render(rows, t.TempDir())
+				return err
+			}()
+			if err == nil || !strings.Contains(err.Error(), c.expected) {
+				t.Errorf("Expected an error containing %q; got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func Test_SendMerge(t *testing.T) {
+	f := newFakeSendAs(t)
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+
+	tmpl, err := ParseMergeTemplate("msg.tmpl", testMergeTemplate)
+	if err != nil {
+		t.Fatalf("Error parsing template: %v", err)
+	}
+	rows, err := ReadMergeData(strings.NewReader("email,name,team\nalice@example.com,Alice,R&D\nbob@example.com,Bob,Sales\ncarol@example.com,Carol,Ops\n"))
+	if err != nil {
+		t.Fatalf("Error reading data: %v", err)
+	}
+	msgs, err := tmpl.Render(rows, "")
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+
+	opts := MergeOptions{From: "support@example.com", Log: filepath.Join(t.TempDir(), "merge.jsonl")}
+	// Simulate a mail merge that was interrupted after sending the first two messages.
+	result, err := inbox.SendMerge(ctx, msgs[:2], opts)
+	if err != nil {
+		t.Fatalf("Error sending: %v", err)
+	}
+	if result.Sent != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// Fixing the template before resuming doesn't resend the messages that were already sent.
+	tmpl, err = ParseMergeTemplate("msg.tmpl", strings.Replace(testMergeTemplate, "Welcome", "Welcome to the team", 1))
+	if err != nil {
+		t.Fatalf("Error parsing template: %v", err)
+	}
+	msgs, err = tmpl.Render(rows, "")
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	result, err = inbox.SendMerge(ctx, msgs, opts)
+	if err != nil {
+		t.Fatalf("Error resuming: %v", err)
+	}
+	if result.Sent != 1 || result.Skipped != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if len(f.sent) != 3 {
+		t.Fatalf("Expected each message to be sent once; got %d", len(f.sent))
+	}
+	for _, expected := range []string{"To: <carol@example.com>\r\n", "From: \"Support\" <support@example.com>\r\n", "Subject: Welcome to the team Carol\r\n"} {
+		if !strings.Contains(f.sent[2], expected) {
+			t.Errorf("Expected the last message to contain %q; got\n%s", expected, f.sent[2])
+		}
+	}
+}
+
+func Test_SendMergeWrongLog(t *testing.T) {
+	f := newFakeSendAs(t)
+	inbox := newFakeInbox(t, f)
+
+	// An import checkpoint isn't a mail merge log.
+	log := filepath.Join(t.TempDir(), "old.mbox.import.jsonl")
+	if err := os.WriteFile(log, []byte(`{"id":"i0","threadId":"t0","path":"/tmp/old.mbox","offset":0,"length":10}`+"\n"), 0o644); err != nil {
+		t.Fatalf("Error writing checkpoint: %v", err)
+	}
+	msgs := []*MergeMessage{{Row: 1, Message: &OutgoingMessage{To: []string{"alice@example.com"}, Subject: "Hi", TextBody: "Hi\n"}}}
+	_, err := inbox.SendMerge(context.Background(), msgs, MergeOptions{Log: log})
+	if err == nil || !strings.Contains(err.Error(), "Failed to parse line 1") {
+		t.Errorf("Expected the log to be rejected; got %v", err)
+	}
+	if len(f.sent) != 0 {
+		t.Errorf("Expected nothing to be sent; got %d messages", len(f.sent))
+	}
+}
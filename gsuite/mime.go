@@ -0,0 +1,123 @@
+package gsuite
+
+import (
+	"encoding/base64"
+	"mime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// MessagePart is a node in the MIME tree of a message.
+// Multipart nodes have children in Parts; leaf nodes describe a body or an attachment.
+type MessagePart struct {
+	PartID   string
+	MimeType string
+	// Filename is the name of the attachment if the part is an attachment.
+	Filename string `json:",omitempty"`
+	// ContentID is the value of the Content-ID header with the angle brackets removed. It is used to reference
+	// inline images from HTML bodies (e.g. <img src="cid:...">).
+	ContentID string `json:",omitempty"`
+	// Disposition is the disposition type from the Content-Disposition header; e.g. "inline" or "attachment".
+	Disposition string `json:",omitempty"`
+	// Size is the size in bytes of the part's body.
+	Size int64
+	// AttachmentID is set when the body of the part must be fetched separately with the attachments API.
+	AttachmentID string         `json:",omitempty"`
+	Parts        []*MessagePart `json:",omitempty"`
+}
+
+// IsMultipart returns true if the part is a container for other parts.
+func (p *MessagePart) IsMultipart() bool {
+	return strings.HasPrefix(p.MimeType, "multipart/")
+}
+
+// IsAttachment returns true if the part is an attachment rather than part of the body of the message.
+func (p *MessagePart) IsAttachment() bool {
+	if p.IsMultipart() {
+		return false
+	}
+	return p.Disposition == "attachment" || p.Filename != ""
+}
+
+// Walk calls fn for the part and each of its descendants in depth first order.
+func (p *MessagePart) Walk(fn func(part *MessagePart, depth int)) {
+	p.walk(fn, 0)
+}
+
+func (p *MessagePart) walk(fn func(part *MessagePart, depth int), depth int) {
+	fn(p, depth)
+	for _, child := range p.Parts {
+		child.walk(fn, depth+1)
+	}
+}
+
+// bodies accumulates the decoded text of the inline text parts of a message.
+type bodies struct {
+	text strings.Builder
+	html strings.Builder
+}
+
+// newMessagePart converts the gmail representation of a part into a MessagePart. The decoded contents of inline
+// text/plain and text/html parts are appended to b.
+func newMessagePart(part *gmail.MessagePart, b *bodies) (*MessagePart, error) {
+	p := &MessagePart{
+		PartID:   part.PartId,
+		MimeType: strings.ToLower(part.MimeType),
+		Filename: part.Filename,
+	}
+	if p.MimeType == "" {
+		// RFC 2045 section 5.2; parts without a Content-Type are plain text.
+		p.MimeType = "text/plain"
+	}
+
+	for _, header := range part.Headers {
+		switch strings.ToLower(header.Name) {
+		case "content-id":
+			p.ContentID = strings.Trim(strings.TrimSpace(header.Value), "<>")
+		case "content-disposition":
+			if disposition, _, err := mime.ParseMediaType(header.Value); err == nil {
+				p.Disposition = disposition
+			}
+		}
+	}
+
+	if part.Body != nil {
+		p.Size = part.Body.Size
+		p.AttachmentID = part.Body.AttachmentId
+	}
+
+	if !p.IsAttachment() && part.Body != nil && part.Body.Data != "" {
+		var sb *strings.Builder
+		switch p.MimeType {
+		case "text/plain":
+			sb = &b.text
+		case "text/html":
+			sb = &b.html
+		}
+
+		if sb != nil {
+			decoded, err := decodeData(part.Body.Data)
+			if err != nil {
+				return p, errors.Wrapf(err, "failed to decode body of part %s", part.PartId)
+			}
+			sb.Write(decoded)
+		}
+	}
+
+	for _, child := range part.Parts {
+		c, err := newMessagePart(child, b)
+		if err != nil {
+			return p, err
+		}
+		p.Parts = append(p.Parts, c)
+	}
+	return p, nil
+}
+
+// decodeData decodes the base64 URL encoded data gmail uses for message bodies. Gmail isn't consistent about
+// padding so we accept data with and without it.
+func decodeData(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
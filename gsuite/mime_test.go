@@ -0,0 +1,106 @@
+package gsuite
+
+import (
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func Test_NewEmailNestedMultipart(t *testing.T) {
+	// multipart/mixed
+	//   multipart/related
+	//     multipart/alternative
+	//       text/plain
+	//       text/html
+	//     image/png (inline)
+	//   application/pdf (attachment)
+	msg := &gmail.Message{
+		Id: "m1",
+		Payload: &gmail.MessagePart{
+			PartId:   "",
+			MimeType: "multipart/mixed",
+			Body:     &gmail.MessagePartBody{},
+			Parts: []*gmail.MessagePart{
+				{
+					PartId:   "0",
+					MimeType: "multipart/related",
+					Body:     &gmail.MessagePartBody{},
+					Parts: []*gmail.MessagePart{
+						{
+							PartId:   "0.0",
+							MimeType: "multipart/alternative",
+							Body:     &gmail.MessagePartBody{},
+							Parts: []*gmail.MessagePart{
+								{PartId: "0.0.0", MimeType: "text/plain", Body: &gmail.MessagePartBody{Data: encodeData("plain body"), Size: 10}},
+								{PartId: "0.0.1", MimeType: "text/html", Body: &gmail.MessagePartBody{Data: encodeData("<p>html body</p>"), Size: 16}},
+							},
+						},
+						{
+							PartId:   "0.1",
+							MimeType: "image/png",
+							Filename: "logo.png",
+							Headers: []*gmail.MessagePartHeader{
+								{Name: "Content-ID", Value: "<logo@example.com>"},
+								{Name: "Content-Disposition", Value: `inline; filename="logo.png"`},
+							},
+							Body: &gmail.MessagePartBody{AttachmentId: "a1", Size: 100},
+						},
+					},
+				},
+				{
+					PartId:   "1",
+					MimeType: "application/pdf",
+					Filename: "invoice.pdf",
+					Headers: []*gmail.MessagePartHeader{
+						{Name: "Content-Disposition", Value: `attachment; filename="invoice.pdf"`},
+					},
+					Body: &gmail.MessagePartBody{AttachmentId: "a2", Size: 2000},
+				},
+			},
+		},
+	}
+
+	email, err := newEmail(msg)
+	if err != nil {
+		t.Fatalf("Error converting message: %v", err)
+	}
+
+	if email.TextBody != "plain body" {
+		t.Errorf("Expected text body %q; got %q", "plain body", email.TextBody)
+	}
+	if email.HTMLBody != "<p>html body</p>" {
+		t.Errorf("Expected html body %q; got %q", "<p>html body</p>", email.HTMLBody)
+	}
+	if email.Body != email.TextBody {
+		t.Errorf("Expected body to be the text body; got %q", email.Body)
+	}
+
+	var ids []string
+	email.Payload.Walk(func(p *MessagePart, depth int) {
+		ids = append(ids, p.PartID)
+	})
+	if len(ids) != 7 {
+		t.Fatalf("Expected 7 parts; got %v", ids)
+	}
+
+	logo := email.Payload.Parts[0].Parts[1]
+	if logo.ContentID != "logo@example.com" {
+		t.Errorf("Expected content id %q; got %q", "logo@example.com", logo.ContentID)
+	}
+	if logo.Disposition != "inline" || !logo.IsAttachment() {
+		t.Errorf("Expected logo to be an inline attachment; got %+v", logo)
+	}
+
+	pdf := email.Payload.Parts[1]
+	if pdf.Filename != "invoice.pdf" || pdf.AttachmentID != "a2" || pdf.Size != 2000 {
+		t.Errorf("Unexpected attachment part %+v", pdf)
+	}
+}
+
+func Test_DecodeData(t *testing.T) {
+	for _, data := range []string{"aGk_Pz4-", "aGk_Pz4-Pw", "aGk_Pz4-Pw=="} {
+		if _, err := decodeData(data); err != nil {
+			t.Errorf("Error decoding %q: %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package gsuite
+
+import (
+	"context"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+)
+
+// System label ids that are used to implement common operations.
+const (
+	inboxLabel   = "INBOX"
+	unreadLabel  = "UNREAD"
+	starredLabel = "STARRED"
+	trashLabel   = "TRASH"
+	spamLabel    = "SPAM"
+)
+
+// Modification describes changes to apply to a set of messages.
+type Modification struct {
+	// AddLabels and RemoveLabels are label names or ids.
+	AddLabels    []string
+	RemoveLabels []string
+	// Archive removes the messages from the inbox.
+	Archive    bool
+	MarkRead   bool
+	MarkUnread bool
+	Star       bool
+	Unstar     bool
+	// Trash moves the messages to the trash and Untrash moves them out of it.
+	Trash   bool
+	Untrash bool
+}
+
+// ModifyResult is the result of applying a Modification to the messages matching a query.
+type ModifyResult struct {
+	// Matched is the number of messages that matched the query.
+	Matched int
+	// Sample is a sample of the matched messages.
+	Sample []*EmailInfo
+	// Applied is false when it was a dry run.
+	Applied bool
+}
+
+// labelChanges converts the modification into the label ids to add and remove.
+func (i *Inbox) labelChanges(ctx context.Context, mod *Modification) ([]string, []string, error) {
+	conflicts := []struct {
+		a, b    bool
+		message string
+	}{
+		{mod.MarkRead, mod.MarkUnread, "mark read and mark unread"},
+		{mod.Star, mod.Unstar, "star and unstar"},
+		{mod.Trash, mod.Untrash, "trash and untrash"},
+	}
+	for _, c := range conflicts {
+		if c.a && c.b {
+			return nil, nil, errors.Errorf("Can't %s at the same time", c.message)
+		}
+	}
+
+	add, err := i.labelIDs(ctx, mod.AddLabels)
+	if err != nil {
+		return nil, nil, err
+	}
+	remove, err := i.labelIDs(ctx, mod.RemoveLabels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := []struct {
+		enabled bool
+		list    *[]string
+		label   string
+	}{
+		{mod.Archive, &remove, inboxLabel},
+		{mod.MarkRead, &remove, unreadLabel},
+		{mod.MarkUnread, &add, unreadLabel},
+		{mod.Star, &add, starredLabel},
+		{mod.Unstar, &remove, starredLabel},
+		{mod.Trash, &add, trashLabel},
+		{mod.Untrash, &remove, trashLabel},
+	}
+	for _, c := range changes {
+		if c.enabled {
+			*c.list = append(*c.list, c.label)
+		}
+	}
+
+	if len(add)+len(remove) == 0 {
+		return nil, nil, errors.New("Modification doesn't change anything")
+	}
+	return add, remove, nil
+}
+
+// ModifyQuery applies mod to every message matching query. The query uses the same syntax as Search.
+// If dryRun is true the messages are only counted and sampled and nothing is modified. sampleSize is the maximum
+// number of messages to include in the result's sample.
+func (i *Inbox) ModifyQuery(ctx context.Context, query string, mod *Modification, dryRun bool, sampleSize int) (*ModifyResult, error) {
+	log := util.LoggerFromContext(ctx)
+	add, remove, err := i.labelChanges(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gmail excludes the trash from searches unless asked so untrashing needs to include it.
+	ids, _, err := i.listMessageIDs(ctx, query, 0, "", mod.Untrash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ModifyResult{Matched: len(ids)}
+	sampleSize = max(0, min(sampleSize, len(ids)))
+	result.Sample = i.fetchInfos(ctx, ids[:sampleSize])
+
+	if dryRun {
+		return result, nil
+	}
+
+	log.Info("Modifying messages", "query", query, "count", len(ids), "addLabelIds", add, "removeLabelIds", remove)
+	if err := i.batchModify(ctx, ids, add, remove); err != nil {
+		return result, err
+	}
+	result.Applied = true
+	return result, nil
+}
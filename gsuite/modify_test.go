@@ -0,0 +1,47 @@
+package gsuite
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_ModifyQuery(t *testing.T) {
+	fake := &fakeMessages{t: t, count: 5, pageSize: 2}
+	inbox := newFakeInbox(t, fake)
+	ctx := context.Background()
+
+	mod := &Modification{Archive: true, MarkRead: true}
+	result, err := inbox.ModifyQuery(ctx, "from:newsletter@example.com", mod, true, 3)
+	if err != nil {
+		t.Fatalf("Error running dry run: %v", err)
+	}
+	if result.Matched != 5 || len(result.Sample) != 3 || result.Applied {
+		t.Errorf("Unexpected dry run result %+v", result)
+	}
+	if len(fake.modified) != 0 {
+		t.Fatalf("Dry run modified messages")
+	}
+
+	result, err = inbox.ModifyQuery(ctx, "from:newsletter@example.com", mod, false, 0)
+	if err != nil {
+		t.Fatalf("Error modifying messages: %v", err)
+	}
+	if !result.Applied || len(fake.modified) != 1 {
+		t.Fatalf("Expected one batch modify request; got %d", len(fake.modified))
+	}
+	req := fake.modified[0]
+	if len(req.Ids) != 5 || strings.Join(req.RemoveLabelIds, ",") != "INBOX,UNREAD" || len(req.AddLabelIds) != 0 {
+		t.Errorf("Unexpected batch modify request %+v", req)
+	}
+}
+
+func Test_ModifyQueryConflicts(t *testing.T) {
+	inbox := newFakeInbox(t, &fakeMessages{t: t})
+	if _, err := inbox.ModifyQuery(context.Background(), "", &Modification{Star: true, Unstar: true}, true, 0); err == nil {
+		t.Errorf("Expected an error for conflicting modifications")
+	}
+	if _, err := inbox.ModifyQuery(context.Background(), "", &Modification{}, true, 0); err == nil {
+		t.Errorf("Expected an error for an empty modification")
+	}
+}
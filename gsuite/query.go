@@ -0,0 +1,181 @@
+package gsuite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Query builds a gmail search query. Terms are combined with AND and the zero value matches every message.
+// Methods return the query so that calls can be chained; e.g. NewQuery().From("alice@example.com").IsUnread().
+//
+// https://support.google.com/mail/answer/7190
+type Query struct {
+	terms []string
+}
+
+// NewQuery returns an empty query.
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// String returns the query in gmail's search syntax.
+func (q *Query) String() string {
+	return strings.Join(q.terms, " ")
+}
+
+// Raw adds a query written in gmail's search syntax. Empty queries are ignored.
+func (q *Query) Raw(query string) *Query {
+	if query = strings.TrimSpace(query); query != "" {
+		q.terms = append(q.terms, query)
+	}
+	return q
+}
+
+// From matches messages sent by address. Like gmail it also matches part of an address or a name.
+func (q *Query) From(address string) *Query {
+	return q.Raw("from:" + quoteQueryValue(address))
+}
+
+// To matches messages sent to address.
+func (q *Query) To(address string) *Query {
+	return q.Raw("to:" + quoteQueryValue(address))
+}
+
+// Subject matches messages whose subject contains the words in subject.
+func (q *Query) Subject(subject string) *Query {
+	return q.Raw("subject:" + quoteQueryValue(subject))
+}
+
+// Label matches messages with the label. Spaces and slashes in the name are written as dashes, which is how
+// gmail refers to nested labels and labels with spaces; e.g. Work/Projects is label:work-projects.
+func (q *Query) Label(name string) *Query {
+	return q.Raw("label:" + strings.NewReplacer(" ", "-", labelSeparator, "-").Replace(strings.ToLower(name)))
+}
+
+// HasAttachment matches messages with attachments.
+func (q *Query) HasAttachment() *Query {
+	return q.Raw("has:attachment")
+}
+
+// IsUnread matches unread messages.
+func (q *Query) IsUnread() *Query {
+	return q.Raw("is:unread")
+}
+
+// After matches messages received after t. The time is passed to gmail as seconds since the epoch so it isn't
+// rounded to a day in gmail's time zone.
+func (q *Query) After(t time.Time) *Query {
+	return q.Raw(fmt.Sprintf("after:%d", t.Unix()))
+}
+
+// Before matches messages received before t.
+func (q *Query) Before(t time.Time) *Query {
+	return q.Raw(fmt.Sprintf("before:%d", t.Unix()))
+}
+
+// Larger matches messages larger than size bytes.
+func (q *Query) Larger(size int64) *Query {
+	return q.Raw(fmt.Sprintf("larger:%d", size))
+}
+
+// Or matches messages matching any of the queries. Empty queries are ignored.
+func (q *Query) Or(queries ...*Query) *Query {
+	groups := make([]string, 0, len(queries))
+	for _, sub := range queries {
+		if len(sub.terms) > 0 {
+			groups = append(groups, sub.group())
+		}
+	}
+	if len(groups) == 1 {
+		return q.Raw(groups[0])
+	}
+	if len(groups) > 1 {
+		q.Raw("(" + strings.Join(groups, " OR ") + ")")
+	}
+	return q
+}
+
+// Not matches messages that don't match sub.
+func (q *Query) Not(sub *Query) *Query {
+	if len(sub.terms) == 0 {
+		return q
+	}
+	return q.Raw("-" + sub.group())
+}
+
+// group returns the query as a single term. OR binds more tightly than AND in gmail's syntax so queries with more
+// than one term need parentheses when they are combined with OR or negated.
+func (q *Query) group() string {
+	if len(q.terms) == 1 && !strings.ContainsAny(q.terms[0], " \t") {
+		return q.terms[0]
+	}
+	return "(" + q.String() + ")"
+}
+
+// quoteQueryValue quotes values containing whitespace or characters with special meaning in queries. Gmail
+// doesn't support escaping quotes so they are removed.
+func quoteQueryValue(value string) string {
+	value = strings.ReplaceAll(strings.TrimSpace(value), `"`, "")
+	if strings.ContainsAny(value, " \t(){}") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// relativeDateRe matches relative dates such as 7d, 2 weeks or 3 months ago.
+var relativeDateRe = regexp.MustCompile(`^(\d+)\s*(h|hours?|d|days?|w|weeks?|m|months?|y|years?)(\s+ago)?$`)
+
+// ParseSearchDate parses a date used in a search relative to now. It accepts
+//   - relative dates: 12h, 7d, 2w, 3m (months), 1y or the long forms e.g. "2 weeks" and "3 days ago"
+//   - today, yesterday, last week, last month and last year
+//   - absolute dates like 2024/01/31 or 2024-01-31, which mean midnight local time, and RFC 3339 times
+func ParseSearchDate(value string, now time.Time) (time.Time, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch v {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	case "last week":
+		return now.AddDate(0, 0, -7), nil
+	case "last month":
+		return now.AddDate(0, -1, 0), nil
+	case "last year":
+		return now.AddDate(-1, 0, 0), nil
+	}
+
+	if m := relativeDateRe.FindStringSubmatch(v); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "Invalid date %q", value)
+		}
+		switch m[2][0] {
+		case 'h':
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case 'd':
+			return now.AddDate(0, 0, -n), nil
+		case 'w':
+			return now.AddDate(0, 0, -7*n), nil
+		case 'm':
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(value)); err == nil {
+		return t, nil
+	}
+	if t, err := parseQueryDate(v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("Invalid date %q; use a relative date like 7d or 2w, today, yesterday or a date like 2006/01/02", value)
+}
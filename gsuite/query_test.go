@@ -0,0 +1,93 @@
+package gsuite
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Query(t *testing.T) {
+	after := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	type testCase struct {
+		name     string
+		query    *Query
+		expected string
+	}
+	cases := []testCase{
+		{
+			name:     "empty",
+			query:    NewQuery().Raw("  "),
+			expected: "",
+		},
+		{
+			name:     "terms",
+			query:    NewQuery().Raw("budget OR forecast").From("Jane Doe").Label("Work/Q1 Plans").IsUnread().HasAttachment(),
+			expected: `budget OR forecast from:"Jane Doe" label:work-q1-plans is:unread has:attachment`,
+		},
+		{
+			name:     "dates-and-size",
+			query:    NewQuery().After(after).Before(after.AddDate(0, 0, 1)).Larger(1 << 20),
+			expected: "after:1706659200 before:1706745600 larger:1048576",
+		},
+		{
+			name:     "quoting",
+			query:    NewQuery().Subject(`say "hi" (now)`).To("bob@example.com"),
+			expected: `subject:"say hi (now)" to:bob@example.com`,
+		},
+		{
+			name: "groups",
+			query: NewQuery().Or(
+				NewQuery().From("alice@example.com"),
+				NewQuery().From("bob@example.com").Subject("report"),
+				NewQuery(),
+			).Not(NewQuery().Label("done").IsUnread()),
+			expected: "(from:alice@example.com OR (from:bob@example.com subject:report)) -(label:done is:unread)",
+		},
+		{
+			name:     "single-or",
+			query:    NewQuery().Or(NewQuery().Raw("a b")).Not(NewQuery().Raw("spam")),
+			expected: "(a b) -spam",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.query.String(); actual != c.expected {
+				t.Errorf("Got %q; want %q", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_ParseSearchDate(t *testing.T) {
+	now := time.Date(2024, 3, 15, 14, 30, 0, 0, time.Local)
+	type testCase struct {
+		value    string
+		expected time.Time
+	}
+	cases := []testCase{
+		{value: "7d", expected: time.Date(2024, 3, 8, 14, 30, 0, 0, time.Local)},
+		{value: "2 weeks ago", expected: time.Date(2024, 3, 1, 14, 30, 0, 0, time.Local)},
+		{value: "3m", expected: time.Date(2023, 12, 15, 14, 30, 0, 0, time.Local)},
+		{value: "12h", expected: time.Date(2024, 3, 15, 2, 30, 0, 0, time.Local)},
+		{value: "1y", expected: time.Date(2023, 3, 15, 14, 30, 0, 0, time.Local)},
+		{value: "Today", expected: time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local)},
+		{value: "yesterday", expected: time.Date(2024, 3, 14, 0, 0, 0, 0, time.Local)},
+		{value: "last week", expected: time.Date(2024, 3, 8, 14, 30, 0, 0, time.Local)},
+		{value: "2024/01/31", expected: time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local)},
+		{value: "2024-01-31T10:00:00Z", expected: time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			actual, err := ParseSearchDate(c.value, now)
+			if err != nil {
+				t.Fatalf("Error parsing date: %v", err)
+			}
+			if !actual.Equal(c.expected) {
+				t.Errorf("Got %v; want %v", actual, c.expected)
+			}
+		})
+	}
+
+	if _, err := ParseSearchDate("next tuesday", now); err == nil {
+		t.Errorf("Expected an error for an unsupported date")
+	}
+}
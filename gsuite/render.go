@@ -0,0 +1,547 @@
+package gsuite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// RenderFormat is the format message bodies are rendered in for reading in a terminal.
+type RenderFormat string
+
+const (
+	// RenderRaw is the body as it is in the message; HTML if the message has an HTML body.
+	RenderRaw RenderFormat = "raw"
+	// RenderText is plain text with links written after their text.
+	RenderText RenderFormat = "text"
+	// RenderMarkdown is Markdown.
+	RenderMarkdown RenderFormat = "markdown"
+)
+
+// quotedTextHidden replaces quoted replies in rendered bodies.
+const quotedTextHidden = "[quoted text hidden]"
+
+var (
+	// attributionLine matches the line mail clients add before a quoted reply; e.g. "On Mon, Jan 1, 2024 Bob wrote:".
+	attributionLine = regexp.MustCompile(`^On .*wrote:\s*$`)
+	blankLines      = regexp.MustCompile(`\n{3,}`)
+)
+
+// Render returns the body of the message in the given format. For RenderText and RenderMarkdown the HTML body is
+// converted to readable text keeping links, lists and tables, tracking pixels are removed and quoted replies are
+// collapsed. Messages without an HTML body are rendered from their text body.
+func (e *Email) Render(format RenderFormat) (string, error) {
+	switch format {
+	case RenderRaw:
+		if e.HTMLBody != "" {
+			return e.HTMLBody, nil
+		}
+		return e.TextBody, nil
+	case RenderText, RenderMarkdown:
+		if e.HTMLBody != "" {
+			return RenderHTML(e.HTMLBody, format)
+		}
+		return collapseQuotedText(strings.ReplaceAll(e.TextBody, "\r\n", "\n")), nil
+	default:
+		return "", errors.Errorf("Unknown render format %q; must be one of raw, text or markdown", format)
+	}
+}
+
+// RenderHTML converts an HTML body to text or Markdown.
+func RenderHTML(body string, format RenderFormat) (string, error) {
+	if format != RenderText && format != RenderMarkdown {
+		return "", errors.Errorf("Can't render HTML as %q", format)
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse HTML")
+	}
+	r := &htmlRenderer{markdown: format == RenderMarkdown}
+	r.render(doc)
+	return r.String(), nil
+}
+
+// htmlToText converts an HTML body to plain text without collapsing quoted replies so that none of the message is
+// lost when it is quoted or forwarded.
+func htmlToText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse HTML")
+	}
+	r := &htmlRenderer{keepQuotes: true}
+	r.render(doc)
+	return r.String(), nil
+}
+
+// htmlRenderer converts an HTML tree to text. Block elements are separated by newlines and inline text has its
+// whitespace collapsed like a browser does.
+type htmlRenderer struct {
+	markdown bool
+	// keepQuotes renders quoted replies instead of collapsing them.
+	keepQuotes bool
+	sb         strings.Builder
+	// newlines is the number of newlines to write before the next text.
+	newlines int
+	// indent is written at the start of each line; it lines up the lines of list items.
+	indent string
+	// pre is greater than zero inside <pre> where whitespace is preserved.
+	pre int
+	// lists is a stack of the open lists; each entry is the next item number or -1 for unordered lists.
+	lists []int
+	// last is the last byte written.
+	last byte
+}
+
+// String returns the rendered text.
+func (r *htmlRenderer) String() string {
+	lines := strings.Split(r.sb.String(), "\n")
+	for n, l := range lines {
+		lines[n] = strings.TrimRight(l, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// block ensures the next text starts at least n lines below the current text.
+func (r *htmlRenderer) block(n int) {
+	if r.sb.Len() > 0 {
+		r.newlines = max(r.newlines, n)
+	}
+}
+
+// write writes s as is, starting a new line first if a block was requested.
+func (r *htmlRenderer) write(s string) {
+	if s == "" {
+		return
+	}
+	if r.newlines > 0 {
+		r.sb.WriteString(strings.Repeat("\n", r.newlines))
+		r.sb.WriteString(r.indent)
+		r.newlines = 0
+	}
+	r.sb.WriteString(s)
+	r.last = s[len(s)-1]
+}
+
+// text writes a text node collapsing whitespace.
+func (r *htmlRenderer) text(s string) {
+	if r.pre > 0 {
+		lines := strings.Split(s, "\n")
+		for n, l := range lines {
+			if n > 0 {
+				r.newlines++
+			}
+			r.write(l)
+		}
+		return
+	}
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if collapsed == "" {
+		if len(s) > 0 && !r.atLineStart() {
+			r.write(" ")
+		}
+		return
+	}
+	if startsWithSpace(s) && !r.atLineStart() {
+		collapsed = " " + collapsed
+	}
+	if endsWithSpace(s) {
+		collapsed += " "
+	}
+	r.write(collapsed)
+}
+
+func (r *htmlRenderer) atLineStart() bool {
+	return r.newlines > 0 || r.sb.Len() == 0 || r.last == '\n' || r.last == ' '
+}
+
+func (r *htmlRenderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+// inline renders the children of n into a single line of text.
+func (r *htmlRenderer) inline(n *html.Node) string {
+	sub := &htmlRenderer{markdown: r.markdown}
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.String()), " ")
+}
+
+func (r *htmlRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.DocumentNode:
+		r.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if isHidden(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title, atom.Meta, atom.Noscript, atom.Template:
+		return
+	case atom.Br:
+		if r.sb.Len() > 0 {
+			r.newlines++
+		}
+	case atom.Hr:
+		r.block(2)
+		r.write("---")
+		r.block(2)
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Center:
+		if isQuote(n) && !r.keepQuotes {
+			r.quote()
+			return
+		}
+		r.block(1)
+		if n.DataAtom == atom.P {
+			r.block(2)
+		}
+		r.children(n)
+		r.block(1)
+		if n.DataAtom == atom.P {
+			r.block(2)
+		}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block(2)
+		text := r.inline(n)
+		if r.markdown {
+			level, _ := strconv.Atoi(n.Data[1:])
+			text = strings.Repeat("#", level) + " " + text
+		}
+		r.write(text)
+		r.block(2)
+	case atom.Blockquote:
+		// Only quoted replies are collapsed; other quotations, e.g. in newsletters, are part of the message.
+		if isQuote(n) && !r.keepQuotes {
+			r.quote()
+			return
+		}
+		r.block(2)
+		r.children(n)
+		r.block(2)
+	case atom.Ul, atom.Ol:
+		next := -1
+		if n.DataAtom == atom.Ol {
+			next = 1
+			if start, err := strconv.Atoi(getAttr(n, "start")); err == nil {
+				next = start
+			}
+		}
+		r.lists = append(r.lists, next)
+		r.block(1)
+		if len(r.lists) == 1 {
+			r.block(2)
+		}
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		r.block(1)
+		if len(r.lists) == 0 {
+			r.block(2)
+		}
+	case atom.Li:
+		r.listItem(n)
+	case atom.Pre:
+		r.block(2)
+		if r.markdown {
+			r.write("```")
+			r.block(1)
+		}
+		r.pre++
+		r.children(n)
+		r.pre--
+		if r.markdown {
+			r.block(1)
+			r.write("```")
+		}
+		r.block(2)
+	case atom.Table:
+		r.table(n)
+	case atom.A:
+		r.link(n)
+	case atom.Img:
+		r.image(n)
+	case atom.B, atom.Strong:
+		r.emphasis(n, "**")
+	case atom.I, atom.Em:
+		r.emphasis(n, "_")
+	case atom.Code:
+		if r.pre > 0 {
+			r.children(n)
+			return
+		}
+		r.emphasis(n, "`")
+	default:
+		r.children(n)
+	}
+}
+
+// quote replaces a quoted reply.
+func (r *htmlRenderer) quote() {
+	r.block(2)
+	r.write(quotedTextHidden)
+	r.block(2)
+}
+
+func (r *htmlRenderer) listItem(n *html.Node) {
+	marker := "- "
+	if len(r.lists) > 0 {
+		if next := r.lists[len(r.lists)-1]; next >= 0 {
+			marker = fmt.Sprintf("%d. ", next)
+			r.lists[len(r.lists)-1]++
+		}
+	}
+	parent := r.indent
+	r.block(1)
+	r.write(marker)
+	// Continuation lines of the item line up with the text after the marker.
+	r.indent = parent + strings.Repeat(" ", len(marker))
+	r.children(n)
+	r.indent = parent
+	r.block(1)
+}
+
+func (r *htmlRenderer) link(n *html.Node) {
+	href := strings.TrimSpace(getAttr(n, "href"))
+	text := r.inline(n)
+	switch {
+	case href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:"):
+		r.text(text)
+	case text == "":
+		r.write(href)
+	case r.markdown:
+		r.write(fmt.Sprintf("[%s](%s)", text, href))
+	case text == href || "mailto:"+text == href:
+		r.write(text)
+	default:
+		r.write(fmt.Sprintf("%s (%s)", text, href))
+	}
+}
+
+func (r *htmlRenderer) image(n *html.Node) {
+	if isTrackingPixel(n) {
+		return
+	}
+	alt := strings.TrimSpace(getAttr(n, "alt"))
+	src := getAttr(n, "src")
+	if r.markdown && src != "" && !strings.HasPrefix(src, "cid:") {
+		r.write(fmt.Sprintf("![%s](%s)", alt, src))
+		return
+	}
+	if alt != "" {
+		r.write("[image: " + alt + "]")
+	}
+}
+
+func (r *htmlRenderer) emphasis(n *html.Node, marker string) {
+	if !r.markdown {
+		r.children(n)
+		return
+	}
+	text := r.inline(n)
+	if text == "" {
+		return
+	}
+	r.write(marker + text + marker)
+}
+
+// table renders tables of data as rows of cells separated by "|". Emails often use tables for layout so tables
+// whose rows only have a single cell or that contain other tables are rendered as blocks instead.
+func (r *htmlRenderer) table(n *html.Node) {
+	rows := tableRows(n)
+	columns := 0
+	layout := false
+	for _, row := range rows {
+		columns = max(columns, len(row))
+		for _, cell := range row {
+			if findElement(cell, atom.Table) != nil {
+				layout = true
+			}
+		}
+	}
+	if layout || columns < 2 {
+		for _, row := range rows {
+			for _, cell := range row {
+				r.block(1)
+				r.children(cell)
+				r.block(1)
+			}
+		}
+		return
+	}
+
+	r.block(2)
+	for i, row := range rows {
+		cells := make([]string, 0, columns)
+		for _, cell := range row {
+			cells = append(cells, strings.ReplaceAll(r.inline(cell), "|", `\|`))
+		}
+		for len(cells) < columns {
+			cells = append(cells, "")
+		}
+		r.block(1)
+		r.write("| " + strings.Join(cells, " | ") + " |")
+		if i == 0 && r.markdown {
+			r.block(1)
+			r.write(strings.Repeat("| --- ", columns) + "|")
+		}
+	}
+	r.block(2)
+}
+
+// tableRows returns the cells of each row of the table excluding rows of nested tables.
+func tableRows(table *html.Node) [][]*html.Node {
+	rows := make([][]*html.Node, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Tr:
+				cells := make([]*html.Node, 0)
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						cells = append(cells, cell)
+					}
+				}
+				rows = append(rows, cells)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			}
+		}
+	}
+	walk(table)
+	return rows
+}
+
+// findElement returns the first descendant of n with the given tag.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			return c
+		}
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isQuote returns true for the elements gmail and other clients wrap quoted replies in. Apple Mail and Thunderbird
+// mark the blockquote of a reply with type="cite".
+func isQuote(n *html.Node) bool {
+	if n.DataAtom == atom.Blockquote && strings.EqualFold(getAttr(n, "type"), "cite") {
+		return true
+	}
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		switch class {
+		case "gmail_quote", "yahoo_quoted", "moz-cite-prefix":
+			return true
+		}
+	}
+	return getAttr(n, "id") == "divRplyFwdMsg" || getAttr(n, "id") == "appendonsend"
+}
+
+// isHidden returns true if the element's style hides it.
+func isHidden(n *html.Node) bool {
+	style := strings.ReplaceAll(strings.ToLower(getAttr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// isTrackingPixel returns true for images that are too small to see. They are used to track when mail is read.
+func isTrackingPixel(n *html.Node) bool {
+	tiny := func(v string) bool {
+		v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+		size, err := strconv.Atoi(v)
+		return err == nil && size <= 1
+	}
+	if tiny(getAttr(n, "width")) || tiny(getAttr(n, "height")) {
+		return true
+	}
+	for _, decl := range strings.Split(getAttr(n, "style"), ";") {
+		name, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "width", "height", "max-width", "max-height":
+			if tiny(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n\f") != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n\f") != s
+}
+
+// collapseQuotedText replaces quoted replies in a plain text body, the lines starting with ">" along with the
+// attribution line before them, with a marker.
+func collapseQuotedText(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for n := 0; n < len(lines); n++ {
+		if !strings.HasPrefix(lines[n], ">") {
+			out = append(out, lines[n])
+			continue
+		}
+		// Skip the rest of the quote including blank lines within it.
+		end := n
+		for m := n; m < len(lines); m++ {
+			if strings.HasPrefix(lines[m], ">") {
+				end = m
+			} else if strings.TrimSpace(lines[m]) != "" {
+				break
+			}
+		}
+		n = end
+
+		// Drop the attribution line and blank lines before the quote.
+		out = trimBlankLines(out)
+		if len(out) > 0 && attributionLine.MatchString(out[len(out)-1]) {
+			out = trimBlankLines(out[:len(out)-1])
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, quotedTextHidden)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// trimBlankLines removes trailing blank lines.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,137 @@
+package gsuite
+
+import (
+	"testing"
+)
+
+func Test_RenderHTML(t *testing.T) {
+	type testCase struct {
+		name     string
+		html     string
+		format   RenderFormat
+		expected string
+	}
+	cases := []testCase{
+		{
+			name:     "paragraphs",
+			html:     "<html><head><title>x</title><style>p {}</style></head><body><p>Hello\n   there</p><p>Second<br>line</p></body></html>",
+			format:   RenderText,
+			expected: "Hello there\n\nSecond\nline",
+		},
+		{
+			name:     "link-text",
+			html:     `<p>See <a href="https://example.com/doc">the doc</a> and <a href="https://example.com">https://example.com</a>.</p>`,
+			format:   RenderText,
+			expected: "See the doc (https://example.com/doc) and https://example.com.",
+		},
+		{
+			name:     "link-markdown",
+			html:     `<p>See <a href="https://example.com/doc">the <b>doc</b></a></p>`,
+			format:   RenderMarkdown,
+			expected: "See [the **doc**](https://example.com/doc)",
+		},
+		{
+			name:     "lists",
+			html:     "<p>Agenda</p><ol><li>One</li><li>Two<ul><li>Nested</li></ul></li></ol><p>Done</p>",
+			format:   RenderMarkdown,
+			expected: "Agenda\n\n1. One\n2. Two\n   - Nested\n\nDone",
+		},
+		{
+			name:     "table-markdown",
+			html:     "<table><tr><th>Name</th><th>Count</th></tr><tr><td>a|b</td><td>2</td></tr></table>",
+			format:   RenderMarkdown,
+			expected: "| Name | Count |\n| --- | --- |\n| a\\|b | 2 |",
+		},
+		{
+			name:     "table-text",
+			html:     "<table><tr><td>Name</td><td>Count</td></tr><tr><td>a</td></tr></table>",
+			format:   RenderText,
+			expected: "| Name | Count |\n| a |  |",
+		},
+		{
+			name:     "layout-table",
+			html:     "<table><tr><td><p>Header</p></td></tr><tr><td><table><tr><td>Body</td><td>x</td></tr></table></td></tr></table>",
+			format:   RenderText,
+			expected: "Header\n\n| Body | x |",
+		},
+		{
+			name:     "tracking-pixels",
+			html:     `<p>Hi<img src="https://t.example.com/open.gif" width="1" height="1"><img src="https://t.example.com/o" style="width: 0px; height: 0px"><img src="https://example.com/logo.png" alt="Logo"></p>`,
+			format:   RenderMarkdown,
+			expected: "Hi![Logo](https://example.com/logo.png)",
+		},
+		{
+			name:     "image-text",
+			html:     `<p><img src="cid:logo" alt="Logo"> Hi</p>`,
+			format:   RenderText,
+			expected: "[image: Logo] Hi",
+		},
+		{
+			name:     "hidden",
+			html:     `<div style="display: none">preheader</div><p>Visible</p>`,
+			format:   RenderText,
+			expected: "Visible",
+		},
+		{
+			name:     "gmail-quote",
+			html:     `<div>Sounds good</div><br><div class="gmail_quote"><div class="gmail_attr">On Mon, Bob wrote:</div><blockquote>Lunch?</blockquote></div>`,
+			format:   RenderText,
+			expected: "Sounds good\n\n[quoted text hidden]",
+		},
+		{
+			name:     "cite-quote",
+			html:     `<div>Sounds good</div><div>On Mon, Bob wrote:</div><blockquote type="cite"><div>Lunch?</div></blockquote>`,
+			format:   RenderText,
+			expected: "Sounds good\nOn Mon, Bob wrote:\n\n[quoted text hidden]",
+		},
+		{
+			name:     "blockquote",
+			html:     `<p>This week's quote:</p><blockquote><p>Simplicity is prerequisite for reliability.</p></blockquote><p>Enjoy</p>`,
+			format:   RenderText,
+			expected: "This week's quote:\n\nSimplicity is prerequisite for reliability.\n\nEnjoy",
+		},
+		{
+			name:     "heading-and-pre",
+			html:     "<h2>Build  failed</h2><pre>line 1\n  line 2</pre>",
+			format:   RenderMarkdown,
+			expected: "## Build failed\n\n```\nline 1\n  line 2\n```",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := RenderHTML(c.html, c.format)
+			if err != nil {
+				t.Fatalf("Error rendering: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Got\n%q\nwant\n%q", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_EmailRender(t *testing.T) {
+	text := "Sounds good\r\n\r\nOn Mon, Jan 1, 2024 at 9:00 AM Bob <bob@example.com> wrote:\r\n> Lunch?\r\n>\r\n> Bob\r\n\r\n-- \r\nAlice"
+	e := &Email{TextBody: text}
+	actual, err := e.Render(RenderText)
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	expected := "Sounds good\n\n[quoted text hidden]\n\n-- \nAlice"
+	if actual != expected {
+		t.Errorf("Got %q; want %q", actual, expected)
+	}
+
+	raw, err := e.Render(RenderRaw)
+	if err != nil || raw != text {
+		t.Errorf("Expected raw to be the body unchanged; got %q, %v", raw, err)
+	}
+
+	e.HTMLBody = "<p>Hello</p>"
+	if actual, err := e.Render(RenderMarkdown); err != nil || actual != "Hello" {
+		t.Errorf("Expected the HTML body to be rendered; got %q, %v", actual, err)
+	}
+	if _, err := e.Render("pdf"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,214 @@
+package gsuite
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PrepareReply fills in m so that it is a reply to the message with id messageID. The caller sets the body of the
+// reply in m; PrepareReply sets the recipients, subject and threading headers and quotes the original message
+// below the body. If all is true the reply goes to all the recipients of the original message except the user's own
+// addresses; the primary address and every send-as alias.
+func (i *Inbox) PrepareReply(ctx context.Context, messageID string, all bool, m *OutgoingMessage) error {
+	orig, err := i.GetMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	primary, err := i.EmailAddress(ctx)
+	if err != nil {
+		return err
+	}
+	aliases, err := i.ListSendAs(ctx)
+	if err != nil {
+		return err
+	}
+	mine := []string{primary}
+	for _, a := range aliases {
+		mine = append(mine, a.Email)
+	}
+
+	to, cc := replyRecipients(orig, mine, all)
+	if len(to)+len(cc) == 0 {
+		return errors.Errorf("Unable to determine who to reply to for message %s", messageID)
+	}
+	m.To = append(m.To, to...)
+	m.Cc = append(m.Cc, cc...)
+	m.Subject = prefixSubject("Re:", orig.Subject)
+	setThreadingHeaders(orig, m)
+
+	attribution := fmt.Sprintf("On %s, %s wrote:", orig.Date.Format("Mon, Jan 2, 2006 at 3:04 PM"), orig.From)
+	if m.TextBody != "" || m.HTMLBody == "" {
+		text, err := origText(orig)
+		if err != nil {
+			return err
+		}
+		m.TextBody = strings.TrimLeft(fmt.Sprintf("%s\n\n%s\n%s", m.TextBody, attribution, quoteText(text)), "\n")
+	}
+	if m.HTMLBody != "" {
+		m.HTMLBody = fmt.Sprintf(`%s<br><div class="gmail_quote">%s<blockquote class="gmail_quote">%s</blockquote></div>`, m.HTMLBody, html.EscapeString(attribution), origHTML(orig))
+	}
+	return nil
+}
+
+// PrepareForward fills in m so that it forwards the message with id messageID. The caller sets the recipients and
+// the body in m; PrepareForward sets the subject, appends the original message to the body and attaches the
+// attachments of the original message.
+func (i *Inbox) PrepareForward(ctx context.Context, messageID string, m *OutgoingMessage) error {
+	orig, err := i.GetMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	m.Subject = prefixSubject("Fwd:", orig.Subject)
+	setThreadingHeaders(orig, m)
+
+	forwarded := fmt.Sprintf("---------- Forwarded message ---------\nFrom: %s\nDate: %s\nSubject: %s\nTo: %s\n", orig.From, orig.Date.Format("Mon, Jan 2, 2006 at 3:04 PM"), orig.Subject, orig.To)
+	if orig.Cc != "" {
+		forwarded += fmt.Sprintf("Cc: %s\n", orig.Cc)
+	}
+	if m.TextBody != "" || m.HTMLBody == "" {
+		text, err := origText(orig)
+		if err != nil {
+			return err
+		}
+		m.TextBody = strings.TrimLeft(fmt.Sprintf("%s\n\n%s\n%s", m.TextBody, forwarded, text), "\n")
+	}
+	if m.HTMLBody != "" {
+		m.HTMLBody = fmt.Sprintf(`%s<br><div class="gmail_quote">%s<br>%s</div>`, m.HTMLBody, strings.ReplaceAll(html.EscapeString(forwarded), "\n", "<br>"), origHTML(orig))
+	}
+
+	for _, a := range attachments(orig) {
+		data, err := i.GetAttachment(ctx, a)
+		if err != nil {
+			return err
+		}
+		m.Attachments = append(m.Attachments, &OutgoingAttachment{
+			Filename: a.Filename,
+			MimeType: a.MimeType,
+			Data:     data,
+		})
+	}
+	return nil
+}
+
+// setThreadingHeaders sets the headers and thread id that keep m in the same conversation as orig.
+// https://datatracker.ietf.org/doc/html/rfc5322#section-3.6.4
+func setThreadingHeaders(orig *Email, m *OutgoingMessage) {
+	m.ThreadID = orig.ThreadID
+	if orig.MessageID == "" {
+		return
+	}
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	m.Headers["In-Reply-To"] = orig.MessageID
+	m.Headers["References"] = strings.TrimSpace(strings.Join(strings.Fields(orig.References), " ") + " " + orig.MessageID)
+}
+
+// replyRecipients returns the To and Cc recipients of a reply to orig. mine are the addresses of the authenticated
+// user, i.e. the primary address and send-as aliases, and are never included.
+func replyRecipients(orig *Email, mine []string, all bool) ([]string, []string) {
+	isMine := make(map[string]bool, len(mine))
+	for _, a := range mine {
+		isMine[strings.ToLower(a)] = true
+	}
+	seen := make(map[string]bool, len(mine))
+	for a := range isMine {
+		seen[a] = true
+	}
+	add := func(dest []string, header string) []string {
+		for _, a := range splitAddresses(header) {
+			key := strings.ToLower(a.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			dest = append(dest, a.String())
+		}
+		return dest
+	}
+
+	var to []string
+	fromMe := false
+	for _, a := range splitAddresses(orig.From) {
+		if isMine[strings.ToLower(a.Address)] {
+			fromMe = true
+		}
+	}
+
+	switch {
+	case fromMe:
+		// Replying to a message we sent should go to the original recipients, which is what gmail does.
+		to = add(to, orig.To)
+	case orig.ReplyTo != "":
+		to = add(to, orig.ReplyTo)
+	default:
+		to = add(to, orig.From)
+	}
+
+	if !all {
+		return to, nil
+	}
+	to = add(to, orig.To)
+	cc := add(nil, orig.Cc)
+	return to, cc
+}
+
+// subjectPrefixes are the prefixes that mean a subject is already a reply or a forward. Clients abbreviate
+// forwards differently so "Fw:" and "Fwd:" are equivalent.
+var subjectPrefixes = map[string][]string{
+	"re:":  {"re:"},
+	"fwd:": {"fwd:", "fw:"},
+}
+
+// prefixSubject adds prefix to subject unless it is already there.
+func prefixSubject(prefix string, subject string) string {
+	lower := strings.ToLower(subject)
+	equivalent, ok := subjectPrefixes[strings.ToLower(prefix)]
+	if !ok {
+		equivalent = []string{strings.ToLower(prefix)}
+	}
+	for _, p := range equivalent {
+		if strings.HasPrefix(lower, p) {
+			return subject
+		}
+	}
+	return prefix + " " + subject
+}
+
+// quoteText prefixes each line of text with "> ".
+func quoteText(text string) string {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+	for n, l := range lines {
+		if strings.HasPrefix(l, ">") {
+			lines[n] = ">" + l
+		} else {
+			lines[n] = "> " + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// origText returns the body of orig as plain text. Messages with only an HTML body are converted to text.
+func origText(orig *Email) (string, error) {
+	if orig.TextBody != "" || orig.HTMLBody == "" {
+		return orig.TextBody, nil
+	}
+	text, err := htmlToText(orig.HTMLBody)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to convert the HTML body of message %s to text", orig.ID)
+	}
+	return text, nil
+}
+
+// origHTML returns the body of orig as HTML.
+func origHTML(orig *Email) string {
+	if orig.HTMLBody != "" {
+		return orig.HTMLBody
+	}
+	return strings.ReplaceAll(html.EscapeString(orig.TextBody), "\n", "<br>")
+}
@@ -0,0 +1,116 @@
+package gsuite
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ReplyRecipients(t *testing.T) {
+	type testCase struct {
+		name       string
+		orig       *Email
+		all        bool
+		expectedTo []string
+		expectedCc []string
+	}
+
+	const me = "me@example.com"
+	mine := []string{me, "support@example.com"}
+	cases := []testCase{
+		{
+			name:       "reply",
+			orig:       &Email{From: "Bob <bob@example.com>", To: "me@example.com, al@example.com"},
+			expectedTo: []string{"\"Bob\" <bob@example.com>"},
+		},
+		{
+			name:       "reply-to",
+			orig:       &Email{From: "bob@example.com", ReplyTo: "list@example.com", To: me},
+			expectedTo: []string{"<list@example.com>"},
+		},
+		{
+			name:       "reply-all",
+			orig:       &Email{From: "bob@example.com", To: "\"Me\" <ME@example.com>, al@example.com", Cc: "carol@example.com, bob@example.com"},
+			all:        true,
+			expectedTo: []string{"<bob@example.com>", "<al@example.com>"},
+			expectedCc: []string{"<carol@example.com>"},
+		},
+		{
+			name:       "from-me",
+			orig:       &Email{From: me, To: "al@example.com"},
+			expectedTo: []string{"<al@example.com>"},
+		},
+		{
+			name:       "from-alias",
+			orig:       &Email{From: "Support <support@example.com>", To: "al@example.com"},
+			expectedTo: []string{"<al@example.com>"},
+		},
+		{
+			name:       "reply-all-aliases",
+			orig:       &Email{From: "bob@example.com", To: "support@example.com, me@example.com", Cc: "SUPPORT@example.com, carol@example.com"},
+			all:        true,
+			expectedTo: []string{"<bob@example.com>"},
+			expectedCc: []string{"<carol@example.com>"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			to, cc := replyRecipients(c.orig, mine, c.all)
+			if strings.Join(to, ",") != strings.Join(c.expectedTo, ",") {
+				t.Errorf("Expected To %v; got %v", c.expectedTo, to)
+			}
+			if strings.Join(cc, ",") != strings.Join(c.expectedCc, ",") {
+				t.Errorf("Expected Cc %v; got %v", c.expectedCc, cc)
+			}
+		})
+	}
+}
+
+func Test_SetThreadingHeaders(t *testing.T) {
+	orig := &Email{
+		ThreadID:   "t1",
+		MessageID:  "<m2@example.com>",
+		References: "<m0@example.com>\r\n <m1@example.com>",
+	}
+	m := &OutgoingMessage{}
+	setThreadingHeaders(orig, m)
+
+	if m.ThreadID != "t1" {
+		t.Errorf("Expected thread id t1; got %q", m.ThreadID)
+	}
+	if m.Headers["In-Reply-To"] != "<m2@example.com>" {
+		t.Errorf("Unexpected In-Reply-To %q", m.Headers["In-Reply-To"])
+	}
+	expected := "<m0@example.com> <m1@example.com> <m2@example.com>"
+	if m.Headers["References"] != expected {
+		t.Errorf("Expected References %q; got %q", expected, m.Headers["References"])
+	}
+}
+
+func Test_PrefixSubject(t *testing.T) {
+	if actual := prefixSubject("Re:", "RE: hello"); actual != "RE: hello" {
+		t.Errorf("Expected subject to be unchanged; got %q", actual)
+	}
+	if actual := prefixSubject("Re:", "hello"); actual != "Re: hello" {
+		t.Errorf("Expected Re: hello; got %q", actual)
+	}
+	if actual := prefixSubject("Fwd:", "FW: hello"); actual != "FW: hello" {
+		t.Errorf("Expected Fw: to count as a forward prefix; got %q", actual)
+	}
+}
+
+func Test_OrigText(t *testing.T) {
+	orig := &Email{HTMLBody: `<p>See <b>the plan</b>.</p><div class="gmail_quote"><blockquote>Earlier</blockquote></div>`}
+	text, err := origText(orig)
+	if err != nil {
+		t.Fatalf("Error converting HTML: %v", err)
+	}
+	if expected := "See the plan.\n\nEarlier"; text != expected {
+		t.Errorf("Expected the HTML body to be converted to text keeping quoted replies; got %q", text)
+	}
+
+	orig.TextBody = "plain"
+	if text, _ := origText(orig); text != "plain" {
+		t.Errorf("Expected the text body; got %q", text)
+	}
+}
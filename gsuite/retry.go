@@ -0,0 +1,54 @@
+package gsuite
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	maxAttempts    = 5
+	initialBackoff = 500 * time.Millisecond
+)
+
+// retry calls fn until it succeeds, returns an error that isn't retryable or maxAttempts is reached.
+// Fetching messages concurrently can exceed gmail's per user rate limit so we back off when that happens.
+// https://developers.google.com/gmail/api/guides/handle-errors
+func retry(ctx context.Context, fn func() error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable returns true if err is a rate limit or transient server error.
+func isRetryable(err error) bool {
+	gErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch gErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case http.StatusForbidden:
+		// Gmail reports rate limits as 403s with a reason of rateLimitExceeded or userRateLimitExceeded.
+		for _, e := range gErr.Errors {
+			if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package gsuite
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// SendAs is an address the user can send mail from; the primary address or an alias.
+type SendAs struct {
+	Email       string
+	DisplayName string `json:",omitempty"`
+	ReplyTo     string `json:",omitempty"`
+	// Signature is the HTML signature gmail adds to messages composed in its web UI.
+	Signature string `json:",omitempty"`
+	IsPrimary bool
+	IsDefault bool
+	// VerificationStatus is "accepted" once an alias is verified; only verified aliases can be used.
+	VerificationStatus string `json:",omitempty"`
+}
+
+// ListSendAs returns the addresses the user can send mail from. The list is cached since every message sent from
+// an alias is checked against it.
+func (i *Inbox) ListSendAs(ctx context.Context) ([]*SendAs, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.sendAs != nil {
+		return i.sendAs, nil
+	}
+	resp, err := i.svc.Users.Settings.SendAs.List(authUser).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list send-as aliases")
+	}
+	sendAs := make([]*SendAs, 0, len(resp.SendAs))
+	for _, s := range resp.SendAs {
+		sendAs = append(sendAs, newSendAs(s))
+	}
+	i.sendAs = sendAs
+	return sendAs, nil
+}
+
+func newSendAs(s *gmail.SendAs) *SendAs {
+	return &SendAs{
+		Email:              s.SendAsEmail,
+		DisplayName:        s.DisplayName,
+		ReplyTo:            s.ReplyToAddress,
+		Signature:          s.Signature,
+		IsPrimary:          s.IsPrimary,
+		IsDefault:          s.IsDefault,
+		VerificationStatus: s.VerificationStatus,
+	}
+}
+
+// GetSendAs returns the send-as alias for address. If address is empty the default alias is returned. address can
+// include a display name; e.g. "Jane <jane@example.com>".
+func (i *Inbox) GetSendAs(ctx context.Context, address string) (*SendAs, error) {
+	aliases, err := i.ListSendAs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if address == "" {
+		for _, s := range aliases {
+			if s.IsDefault {
+				return s, nil
+			}
+		}
+		return nil, errors.New("The mailbox doesn't have a default send-as alias")
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid address %q", address)
+	}
+	for _, s := range aliases {
+		if strings.EqualFold(s.Email, parsed.Address) {
+			return s, nil
+		}
+	}
+	return nil, errors.Errorf("%s isn't one of your send-as aliases; run 'gctl mail sendas list' to see them", parsed.Address)
+}
+
+// SetSignature sets the signature of the send-as alias for address. If address is empty the default alias is
+// updated.
+func (i *Inbox) SetSignature(ctx context.Context, address string, signature string) error {
+	log := util.LoggerFromContext(ctx)
+	s, err := i.GetSendAs(ctx, address)
+	if err != nil {
+		return err
+	}
+	// ForceSendFields allows the signature to be cleared.
+	patch := &gmail.SendAs{Signature: signature, ForceSendFields: []string{"Signature"}}
+	if _, err := i.svc.Users.Settings.SendAs.Patch(authUser, s.Email, patch).Context(ctx).Do(); err != nil {
+		return errors.Wrapf(err, "Failed to set the signature of %s", s.Email)
+	}
+	i.mu.Lock()
+	i.sendAs = nil
+	i.mu.Unlock()
+	log.Info("Set signature", "sendAs", s.Email)
+	return nil
+}
+
+// resolveFrom checks that the From address of m is one of the user's send-as aliases and adds the alias's display
+// name if m doesn't have one. Gmail silently replaces addresses that aren't aliases with the primary address so
+// it is better to fail. Messages without a From address are left alone so gmail uses the default alias.
+func (i *Inbox) resolveFrom(ctx context.Context, m *OutgoingMessage) error {
+	if m.From == "" {
+		return nil
+	}
+	s, err := i.GetSendAs(ctx, m.From)
+	if err != nil {
+		return err
+	}
+	if s.VerificationStatus != "" && s.VerificationStatus != "accepted" {
+		return errors.Errorf("The send-as alias %s isn't verified; its status is %s", s.Email, s.VerificationStatus)
+	}
+	parsed, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid address %q", m.From)
+	}
+	if parsed.Name == "" {
+		parsed.Name = s.DisplayName
+	}
+	m.From = parsed.String()
+	return nil
+}
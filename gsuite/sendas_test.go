@@ -0,0 +1,129 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeSendAs is a fake implementation of the send-as settings and send APIs.
+type fakeSendAs struct {
+	t       *testing.T
+	sendAs  map[string]*gmail.SendAs
+	lists   int
+	patched []*gmail.SendAs
+	sent    []string
+}
+
+func (f *fakeSendAs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/settings/sendAs"
+	var resp interface{}
+	switch {
+	case r.URL.Path == "/gmail/v1/users/me/messages/send":
+		msg := &gmail.Message{}
+		if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+			f.t.Errorf("Error decoding message: %v", err)
+		}
+		raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+		if err != nil {
+			f.t.Errorf("Error decoding raw message: %v", err)
+		}
+		f.sent = append(f.sent, string(raw))
+		resp = &gmail.Message{Id: "sent"}
+	case r.URL.Path == prefix:
+		f.lists++
+		list := &gmail.ListSendAsResponse{}
+		for _, email := range []string{"me@example.com", "support@example.com", "pending@example.com"} {
+			list.SendAs = append(list.SendAs, f.sendAs[email])
+		}
+		resp = list
+	case r.Method == http.MethodPatch:
+		email := strings.TrimPrefix(r.URL.Path, prefix+"/")
+		patch := &gmail.SendAs{}
+		if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+			f.t.Errorf("Error decoding patch: %v", err)
+		}
+		f.patched = append(f.patched, patch)
+		f.sendAs[email].Signature = patch.Signature
+		resp = f.sendAs[email]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+func newFakeSendAs(t *testing.T) *fakeSendAs {
+	return &fakeSendAs{
+		t: t,
+		sendAs: map[string]*gmail.SendAs{
+			"me@example.com":      {SendAsEmail: "me@example.com", DisplayName: "Me", IsPrimary: true, Signature: "<b>Me</b>"},
+			"support@example.com": {SendAsEmail: "support@example.com", DisplayName: "Support", IsDefault: true, VerificationStatus: "accepted"},
+			"pending@example.com": {SendAsEmail: "pending@example.com", VerificationStatus: "pending"},
+		},
+	}
+}
+
+func Test_SendFromAlias(t *testing.T) {
+	f := newFakeSendAs(t)
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+
+	for _, from := range []string{"Support@example.com", "Help Desk <support@example.com>"} {
+		if _, err := inbox.Send(ctx, &OutgoingMessage{From: from, To: []string{"bob@example.com"}, Subject: "Hi", TextBody: "Hi"}); err != nil {
+			t.Fatalf("Error sending from %s: %v", from, err)
+		}
+	}
+	for n, expected := range []string{"From: \"Support\" <Support@example.com>\r\n", "From: \"Help Desk\" <support@example.com>\r\n"} {
+		if !strings.Contains(f.sent[n], expected) {
+			t.Errorf("Expected message %d to contain %q; got\n%s", n, expected, f.sent[n])
+		}
+	}
+	if f.lists != 1 {
+		t.Errorf("Expected the aliases to be listed once; got %d", f.lists)
+	}
+
+	for _, from := range []string{"stranger@example.com", "pending@example.com"} {
+		if _, err := inbox.Send(ctx, &OutgoingMessage{From: from, To: []string{"bob@example.com"}}); err == nil {
+			t.Errorf("Expected sending from %s to fail", from)
+		}
+	}
+	if len(f.sent) != 2 {
+		t.Errorf("Expected only the messages from valid aliases to be sent; got %d", len(f.sent))
+	}
+}
+
+func Test_Signature(t *testing.T) {
+	f := newFakeSendAs(t)
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+
+	s, err := inbox.GetSendAs(ctx, "")
+	if err != nil {
+		t.Fatalf("Error getting the default alias: %v", err)
+	}
+	if s.Email != "support@example.com" {
+		t.Errorf("Expected the default alias; got %s", s.Email)
+	}
+
+	if err := inbox.SetSignature(ctx, "me@example.com", ""); err != nil {
+		t.Fatalf("Error setting signature: %v", err)
+	}
+	if len(f.patched) != 1 || f.patched[0].Signature != "" {
+		t.Fatalf("Unexpected patches %+v", f.patched)
+	}
+	s, err = inbox.GetSendAs(ctx, "me@example.com")
+	if err != nil {
+		t.Fatalf("Error getting alias: %v", err)
+	}
+	if s.Signature != "" {
+		t.Errorf("Expected the cached aliases to be refreshed after setting the signature; got %q", s.Signature)
+	}
+}
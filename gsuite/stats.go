@@ -0,0 +1,252 @@
+package gsuite
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PeriodDay and PeriodWeek are the periods message volume can be grouped by.
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+)
+
+// StatsOptions selects the messages to compute statistics over.
+type StatsOptions struct {
+	// Query selects the messages. Include sent mail (the default when the query doesn't restrict it) to get
+	// response times.
+	Query string
+	// MaxResults is the maximum number of messages to scan; if it is <= 0 all the matching messages are scanned.
+	MaxResults int64
+	// Top is the number of entries in the top senders, recipients and largest messages.
+	Top int
+	// Period is PeriodDay or PeriodWeek.
+	Period string
+}
+
+// MailStats are statistics about a set of messages.
+type MailStats struct {
+	Messages      int
+	TopSenders    []*Count
+	TopRecipients []*Count
+	// Volume is the number of messages received in each day or week; weeks start on Monday.
+	Volume []*PeriodCount
+	// UnreadByLabel is the number of unread messages with each label. Unlike the other statistics it counts every
+	// message in the mailbox rather than only the ones matching the query since old unread mail is the backlog.
+	UnreadByLabel []*Count
+	Largest       []*MessageSize
+	// MedianResponseTime is the median time between a message from someone else and our reply in the same
+	// thread. Responses is the number of replies it is computed from.
+	MedianResponseTime time.Duration
+	Responses          int
+}
+
+// Count is the number of messages for a key such as a sender or label.
+type Count struct {
+	Key   string
+	Count int
+}
+
+// PeriodCount is the number of messages in the day or week starting at Start.
+type PeriodCount struct {
+	Start time.Time
+	Count int
+}
+
+// MessageSize identifies a message and its size in bytes.
+type MessageSize struct {
+	ID      string
+	From    string
+	Subject string
+	Date    time.Time
+	Size    int64
+}
+
+// Stats computes statistics over the messages matching opts.Query.
+func (i *Inbox) Stats(ctx context.Context, opts StatsOptions) (*MailStats, error) {
+	me, err := i.EmailAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, _, err := i.listMessageIDs(ctx, opts.Query, opts.MaxResults, "", false)
+	if err != nil {
+		return nil, err
+	}
+	stats := computeStats(i.fetchInfos(ctx, ids), me, opts)
+	stats.UnreadByLabel, err = i.unreadByLabel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// unreadByLabel returns the number of unread messages with each label in the mailbox, most first. Labels without
+// unread messages are left out.
+func (i *Inbox) unreadByLabel(ctx context.Context) ([]*Count, error) {
+	labels, err := i.ListLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Only getting a label returns its message counts.
+	counts := make([]int64, len(labels))
+	errs := make([]error, len(labels))
+	parallel(len(labels), i.fetchWorkers, func(n int) {
+		errs[n] = retry(ctx, func() error {
+			l, err := i.svc.Users.Labels.Get(authUser, labels[n].ID).Context(ctx).Do()
+			if err != nil {
+				return err
+			}
+			counts[n] = l.MessagesUnread
+			return nil
+		})
+	})
+
+	unread := map[string]int{}
+	for n, l := range labels {
+		if errs[n] != nil {
+			return nil, errors.Wrapf(errs[n], "Failed to get the unread count of label %s", l.Name)
+		}
+		if l.ID == unreadLabel || counts[n] == 0 {
+			continue
+		}
+		unread[l.Name] = int(counts[n])
+	}
+	return topCounts(unread, 0), nil
+}
+
+// computeStats computes the statistics of the messages. me is the address of the authenticated user.
+func computeStats(infos []*EmailInfo, me string, opts StatsOptions) *MailStats {
+	me = strings.ToLower(me)
+	stats := &MailStats{Messages: len(infos)}
+	senders := map[string]int{}
+	recipients := map[string]int{}
+	volume := map[time.Time]int{}
+	for _, info := range infos {
+		for _, a := range info.FromAddresses {
+			senders[strings.ToLower(a.Address)]++
+		}
+		for _, a := range append(append([]*Address{}, info.ToAddresses...), info.CcAddresses...) {
+			recipients[strings.ToLower(a.Address)]++
+		}
+		volume[periodStart(info.Date, opts.Period)]++
+	}
+	stats.TopSenders = topCounts(senders, opts.Top)
+	stats.TopRecipients = topCounts(recipients, opts.Top)
+	stats.Volume = volumeSeries(volume, opts.Period)
+	stats.Largest = largestMessages(infos, opts.Top)
+	stats.MedianResponseTime, stats.Responses = medianResponseTime(infos, me)
+	return stats
+}
+
+// topCounts returns the n keys with the most messages, most first. If n is <= 0 all the keys are returned.
+func topCounts(counts map[string]int, n int) []*Count {
+	results := make([]*Count, 0, len(counts))
+	for k, c := range counts {
+		results = append(results, &Count{Key: k, Count: c})
+	}
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Count != results[b].Count {
+			return results[a].Count > results[b].Count
+		}
+		return results[a].Key < results[b].Key
+	})
+	if n > 0 && len(results) > n {
+		results = results[:n]
+	}
+	return results
+}
+
+// periodStart returns the start of the day or week containing t in t's time zone.
+func periodStart(t time.Time, period string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if period != PeriodWeek {
+		return day
+	}
+	// Weekday is 0 on Sunday; weeks start on Monday.
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// volumeSeries returns the counts for every period from the first to the last including periods without messages.
+func volumeSeries(volume map[time.Time]int, period string) []*PeriodCount {
+	if len(volume) == 0 {
+		return []*PeriodCount{}
+	}
+	var first, last time.Time
+	for start := range volume {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	days := 1
+	if period == PeriodWeek {
+		days = 7
+	}
+	series := make([]*PeriodCount, 0)
+	for start := first; !start.After(last); start = start.AddDate(0, 0, days) {
+		series = append(series, &PeriodCount{Start: start, Count: volume[start]})
+	}
+	return series
+}
+
+// largestMessages returns the n largest messages, largest first.
+func largestMessages(infos []*EmailInfo, n int) []*MessageSize {
+	sorted := append([]*EmailInfo{}, infos...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Size > sorted[b].Size
+	})
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	results := make([]*MessageSize, 0, len(sorted))
+	for _, info := range sorted {
+		results = append(results, &MessageSize{ID: info.ID, From: info.From, Subject: info.Subject, Date: info.Date, Size: info.Size})
+	}
+	return results
+}
+
+// medianResponseTime returns the median time it took me to reply in threads I'm part of and the number of replies.
+// A reply is a message from me whose previous message in the thread is from someone else.
+func medianResponseTime(infos []*EmailInfo, me string) (time.Duration, int) {
+	threads := map[string][]*EmailInfo{}
+	for _, info := range infos {
+		threads[info.ThreadID] = append(threads[info.ThreadID], info)
+	}
+	fromMe := func(info *EmailInfo) bool {
+		for _, a := range info.FromAddresses {
+			if strings.EqualFold(a.Address, me) {
+				return true
+			}
+		}
+		return false
+	}
+
+	delays := make([]time.Duration, 0)
+	for _, messages := range threads {
+		sort.Slice(messages, func(a, b int) bool {
+			return messages[a].Date.Before(messages[b].Date)
+		})
+		for n := 1; n < len(messages); n++ {
+			if fromMe(messages[n]) && !fromMe(messages[n-1]) {
+				delays = append(delays, messages[n].Date.Sub(messages[n-1].Date))
+			}
+		}
+	}
+	if len(delays) == 0 {
+		return 0, 0
+	}
+	sort.Slice(delays, func(a, b int) bool {
+		return delays[a] < delays[b]
+	})
+	mid := len(delays) / 2
+	if len(delays)%2 == 1 {
+		return delays[mid], len(delays)
+	}
+	return (delays[mid-1] + delays[mid]) / 2, len(delays)
+}
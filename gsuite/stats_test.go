@@ -0,0 +1,78 @@
+package gsuite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func Test_computeStats(t *testing.T) {
+	day := func(d int, hour int) time.Time {
+		// January 1 2024 is a Monday.
+		return time.Date(2024, 1, d, hour, 0, 0, 0, time.UTC)
+	}
+	info := func(id, thread, from, to string, date time.Time, size int64, labels ...string) *EmailInfo {
+		i := &EmailInfo{ID: id, ThreadID: thread, From: from, To: to, Date: date, Size: size, Labels: labels, LabelIDs: labels}
+		i.parseAddresses()
+		return i
+	}
+	infos := []*EmailInfo{
+		info("m0", "t0", "Alice <alice@example.com>", "me@example.com", day(1, 9), 100, "INBOX", "UNREAD"),
+		info("m1", "t0", "me@example.com", "alice@example.com", day(1, 11), 50, "SENT"),
+		info("m2", "t0", "alice@example.com", "me@example.com, bob@example.com", day(2, 9), 5000, "INBOX"),
+		info("m3", "t0", "Me <ME@example.com>", "alice@example.com", day(2, 13), 70, "SENT"),
+		info("m4", "t1", "bob@example.com", "me@example.com", day(10, 9), 300, "INBOX", "UNREAD", "Work"),
+		info("m5", "t1", "me@example.com", "bob@example.com", day(10, 15), 60, "SENT"),
+	}
+
+	stats := computeStats(infos, "me@example.com", StatsOptions{Top: 2, Period: PeriodWeek})
+	if stats.Messages != 6 {
+		t.Errorf("Expected 6 messages; got %d", stats.Messages)
+	}
+	expectedSenders := []*Count{{Key: "me@example.com", Count: 3}, {Key: "alice@example.com", Count: 2}}
+	if !reflect.DeepEqual(stats.TopSenders, expectedSenders) {
+		t.Errorf("Got senders %+v; want %+v", stats.TopSenders, expectedSenders)
+	}
+	expectedRecipients := []*Count{{Key: "me@example.com", Count: 3}, {Key: "alice@example.com", Count: 2}}
+	if !reflect.DeepEqual(stats.TopRecipients, expectedRecipients) {
+		t.Errorf("Got recipients %+v; want %+v", stats.TopRecipients, expectedRecipients)
+	}
+	expectedVolume := []*PeriodCount{{Start: day(1, 0), Count: 4}, {Start: day(8, 0), Count: 2}}
+	if !reflect.DeepEqual(stats.Volume, expectedVolume) {
+		t.Errorf("Got volume %+v; want %+v", stats.Volume, expectedVolume)
+	}
+	if len(stats.Largest) != 2 || stats.Largest[0].ID != "m2" || stats.Largest[1].ID != "m4" {
+		t.Errorf("Unexpected largest messages %+v", stats.Largest)
+	}
+	// The response times are 2h, 4h and 6h.
+	if stats.Responses != 3 || stats.MedianResponseTime != 4*time.Hour {
+		t.Errorf("Expected a median response time of 4h over 3 responses; got %v over %d", stats.MedianResponseTime, stats.Responses)
+	}
+
+	daily := computeStats(infos, "me@example.com", StatsOptions{Period: PeriodDay})
+	if len(daily.Volume) != 10 || daily.Volume[2].Count != 0 || daily.Volume[9].Count != 2 {
+		t.Errorf("Expected daily volume with empty days filled in; got %+v", daily.Volume)
+	}
+}
+
+func Test_unreadByLabel(t *testing.T) {
+	f := &fakeLabels{t: t, labels: map[string]*gmail.Label{
+		"INBOX":   {Id: "INBOX", Name: "INBOX", Type: "system", MessagesUnread: 1200},
+		"UNREAD":  {Id: "UNREAD", Name: "UNREAD", Type: "system", MessagesUnread: 1300},
+		"Label_1": {Id: "Label_1", Name: "Work", Type: "user", MessagesUnread: 100},
+		"Label_2": {Id: "Label_2", Name: "Receipts", Type: "user"},
+	}}
+	inbox := newFakeInbox(t, f)
+
+	unread, err := inbox.unreadByLabel(context.Background())
+	if err != nil {
+		t.Fatalf("Error counting unread messages: %v", err)
+	}
+	expected := []*Count{{Key: "INBOX", Count: 1200}, {Key: "Work", Count: 100}}
+	if !reflect.DeepEqual(unread, expected) {
+		t.Errorf("Got unread %+v; want %+v", unread, expected)
+	}
+}
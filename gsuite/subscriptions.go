@@ -0,0 +1,249 @@
+package gsuite
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	listUnsubscribeHeader     = "List-Unsubscribe"
+	listUnsubscribePostHeader = "List-Unsubscribe-Post"
+
+	// oneClickBody is the body RFC 8058 requires one-click unsubscribe requests to POST.
+	oneClickBody = "List-Unsubscribe=One-Click"
+)
+
+// unsubscribeClient is used for one-click unsubscribe requests.
+var unsubscribeClient = &http.Client{Timeout: 30 * time.Second}
+
+// Subscription is a newsletter or mailing list identified by its List-Id or, for mail without one, by the sender's
+// address.
+type Subscription struct {
+	// Key is the List-Id of mailing lists and the sender's address otherwise.
+	Key    string
+	ListID string `json:",omitempty"`
+	// Sender is the From header of the most recent message.
+	Sender   string
+	Count    int
+	LastSeen time.Time
+	// UnsubscribeURL and UnsubscribeMailto are the https and mailto URIs in the List-Unsubscribe header of the most
+	// recent message.
+	UnsubscribeURL    string `json:",omitempty"`
+	UnsubscribeMailto string `json:",omitempty"`
+	// OneClick is true if the sender supports RFC 8058 one-click unsubscribe by POSTing to UnsubscribeURL.
+	OneClick bool
+}
+
+// Query returns a query matching the subscription's messages.
+func (s *Subscription) Query() *Query {
+	return subscriptionQuery(s.Key)
+}
+
+// subscriptionQuery returns a query matching the messages of the subscription with the key. Keys containing an @
+// are sender addresses and other keys are list ids.
+func subscriptionQuery(key string) *Query {
+	if strings.Contains(key, "@") {
+		return NewQuery().From(key)
+	}
+	return NewQuery().Raw("list:" + quoteQueryValue(key))
+}
+
+// ListSubscriptions scans up to maxResults messages matching query and groups the ones sent by mailing lists or
+// with a List-Unsubscribe header by List-Id or sender. The subscriptions are sorted by the number of messages,
+// most first. If maxResults is <= 0 all the matching messages are scanned.
+func (i *Inbox) ListSubscriptions(ctx context.Context, query string, maxResults int64) ([]*Subscription, error) {
+	ids, _, err := i.listMessageIDs(ctx, query, maxResults, "", false)
+	if err != nil {
+		return nil, err
+	}
+	infos := i.fetchInfos(ctx, ids, listUnsubscribeHeader, listUnsubscribePostHeader)
+	return groupSubscriptions(infos), nil
+}
+
+// GetSubscription returns the subscription with the key based on the messages matching it and query. query can
+// be used to limit how far back to look. It returns an error if there are no matching messages.
+func (i *Inbox) GetSubscription(ctx context.Context, key string, query string) (*Subscription, error) {
+	q := subscriptionQuery(key).Raw(query).String()
+	subs, err := i.ListSubscriptions(ctx, q, maxListPageSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		if strings.EqualFold(s.Key, key) {
+			return s, nil
+		}
+	}
+	return nil, errors.Errorf("No subscription %s found in messages matching %q", key, q)
+}
+
+// groupSubscriptions groups the messages into subscriptions. Messages that aren't from a mailing list and don't
+// have a List-Unsubscribe header are ignored.
+func groupSubscriptions(infos []*EmailInfo) []*Subscription {
+	byKey := map[string]*Subscription{}
+	for _, info := range infos {
+		unsubscribe := info.Headers[listUnsubscribeHeader]
+		listID := parseListID(info.ListID)
+		if listID == "" && unsubscribe == "" {
+			continue
+		}
+		key := listID
+		if key == "" {
+			if len(info.FromAddresses) == 0 {
+				continue
+			}
+			key = strings.ToLower(info.FromAddresses[0].Address)
+		}
+
+		s, ok := byKey[key]
+		if !ok {
+			s = &Subscription{Key: key, ListID: listID}
+			byKey[key] = s
+		}
+		s.Count++
+		if !s.LastSeen.IsZero() && info.Date.Before(s.LastSeen) {
+			continue
+		}
+		// The most recent message has the most up to date unsubscribe links.
+		s.LastSeen = info.Date
+		s.Sender = info.From
+		s.UnsubscribeURL, s.UnsubscribeMailto = parseListUnsubscribe(unsubscribe)
+		s.OneClick = s.UnsubscribeURL != "" && strings.EqualFold(strings.TrimSpace(info.Headers[listUnsubscribePostHeader]), oneClickBody)
+	}
+
+	subs := make([]*Subscription, 0, len(byKey))
+	for _, s := range byKey {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(a, b int) bool {
+		if subs[a].Count != subs[b].Count {
+			return subs[a].Count > subs[b].Count
+		}
+		return subs[a].Key < subs[b].Key
+	})
+	return subs
+}
+
+// parseListID returns the identifier in a List-Id header; e.g. "Announcements <announce.example.com>" is
+// announce.example.com. RFC 2919 puts it in angle brackets but some lists omit them.
+func parseListID(header string) string {
+	header = strings.TrimSpace(header)
+	if start, end := strings.LastIndex(header, "<"), strings.LastIndex(header, ">"); start >= 0 && end > start {
+		header = header[start+1 : end]
+	}
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// listUnsubscribeRe matches the URIs in a List-Unsubscribe header which RFC 2369 requires to be in angle brackets.
+var listUnsubscribeRe = regexp.MustCompile(`<([^>]+)>`)
+
+// parseListUnsubscribe returns the first https and mailto URIs in a List-Unsubscribe header.
+func parseListUnsubscribe(header string) (string, string) {
+	var httpsURL, mailto string
+	for _, m := range listUnsubscribeRe.FindAllStringSubmatch(header, -1) {
+		uri := strings.TrimSpace(m[1])
+		lower := strings.ToLower(uri)
+		switch {
+		case strings.HasPrefix(lower, "https://") && httpsURL == "":
+			httpsURL = uri
+		case strings.HasPrefix(lower, "mailto:") && mailto == "":
+			mailto = uri
+		}
+	}
+	return httpsURL, mailto
+}
+
+// Unsubscribe unsubscribes from the subscription. It uses RFC 8058 one-click unsubscribe if the sender supports
+// it and otherwise sends the email requested by the mailto URI from the send-as alias from; if from is empty the
+// default alias is used. It returns an error if neither is available since other unsubscribe links have to be
+// opened in a browser.
+func (i *Inbox) Unsubscribe(ctx context.Context, s *Subscription, from string) error {
+	log := util.LoggerFromContext(ctx)
+	switch {
+	case s.OneClick:
+		if err := unsubscribeOneClick(ctx, s.UnsubscribeURL); err != nil {
+			return err
+		}
+		log.Info("Unsubscribed with one-click", "key", s.Key, "url", s.UnsubscribeURL)
+		return nil
+	case s.UnsubscribeMailto != "":
+		m, err := mailtoMessage(s.UnsubscribeMailto)
+		if err != nil {
+			return err
+		}
+		m.From = from
+		if _, err := i.Send(ctx, m); err != nil {
+			return errors.Wrapf(err, "Failed to send the unsubscribe request for %s", s.Key)
+		}
+		log.Info("Unsubscribed by email", "key", s.Key, "to", m.To)
+		return nil
+	case s.UnsubscribeURL != "":
+		return errors.Errorf("%s doesn't support one-click unsubscribe; open %s to unsubscribe", s.Key, s.UnsubscribeURL)
+	default:
+		return errors.Errorf("%s doesn't have a List-Unsubscribe header", s.Key)
+	}
+}
+
+// unsubscribeOneClick sends the RFC 8058 one-click unsubscribe request. The RFC requires the URI to be https.
+func unsubscribeOneClick(ctx context.Context, uri string) error {
+	if !strings.HasPrefix(strings.ToLower(uri), "https://") {
+		return errors.Errorf("One-click unsubscribe requires an https URL; got %s", uri)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(oneClickBody))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request to %s", uri)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := unsubscribeClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to POST to %s", uri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("POST to %s returned %s", uri, resp.Status)
+	}
+	return nil
+}
+
+// mailtoMessage returns the message requested by a mailto URI. The subject and body default to "unsubscribe".
+func mailtoMessage(uri string) (*OutgoingMessage, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid mailto URI %s", uri)
+	}
+	to, err := url.PathUnescape(u.Opaque)
+	if err != nil || to == "" {
+		return nil, errors.Errorf("Invalid mailto URI %s; it doesn't have an address", uri)
+	}
+	params := u.Query()
+	m := &OutgoingMessage{
+		To:       strings.Split(to, ","),
+		Subject:  params.Get("subject"),
+		TextBody: params.Get("body"),
+	}
+	if m.Subject == "" {
+		m.Subject = "unsubscribe"
+	}
+	if m.TextBody == "" {
+		m.TextBody = "unsubscribe"
+	}
+	return m, nil
+}
+
+// ArchiveSubscription removes the subscription's messages from the inbox. It returns the number of messages
+// archived.
+func (i *Inbox) ArchiveSubscription(ctx context.Context, s *Subscription) (int, error) {
+	query := s.Query().Raw("in:inbox").String()
+	result, err := i.ModifyQuery(ctx, query, &Modification{Archive: true}, false, 0)
+	if err != nil {
+		return 0, err
+	}
+	return result.Matched, nil
+}
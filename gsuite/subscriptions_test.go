@@ -0,0 +1,189 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeSubscriptions is a fake implementation of the messages API serving messages with the given headers.
+type fakeSubscriptions struct {
+	t        *testing.T
+	messages map[string][]*gmail.MessagePartHeader
+	// order is the order messages are listed in.
+	order    []string
+	queries  []string
+	sent     []string
+	modified []*gmail.BatchModifyMessagesRequest
+}
+
+func (f *fakeSubscriptions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/messages"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	var resp interface{}
+	switch path {
+	case "":
+		f.queries = append(f.queries, r.URL.Query().Get("q"))
+		list := &gmail.ListMessagesResponse{}
+		for _, id := range f.order {
+			list.Messages = append(list.Messages, &gmail.Message{Id: id})
+		}
+		resp = list
+	case "/send":
+		msg := &gmail.Message{}
+		if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+			f.t.Errorf("Error decoding message: %v", err)
+		}
+		raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+		if err != nil {
+			f.t.Errorf("Error decoding raw message: %v", err)
+		}
+		f.sent = append(f.sent, string(raw))
+		resp = &gmail.Message{Id: "sent"}
+	case "/batchModify":
+		req := &gmail.BatchModifyMessagesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			f.t.Errorf("Error decoding request: %v", err)
+		}
+		f.modified = append(f.modified, req)
+		return
+	default:
+		id := strings.TrimPrefix(path, "/")
+		n := strings.TrimPrefix(id, "m")
+		resp = &gmail.Message{
+			Id:           id,
+			InternalDate: time.Date(2024, 1, int(n[0]-'0')+1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+			Payload:      &gmail.MessagePart{Headers: f.messages[id]},
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+func newFakeSubscriptions(t *testing.T, oneClickURL string) *fakeSubscriptions {
+	header := func(name, value string) *gmail.MessagePartHeader {
+		return &gmail.MessagePartHeader{Name: name, Value: value}
+	}
+	return &fakeSubscriptions{
+		t: t,
+		messages: map[string][]*gmail.MessagePartHeader{
+			"m0": {
+				header("From", "News <news@example.com>"),
+				header("List-Id", "Example News <news.example.com>"),
+				header("List-Unsubscribe", "<mailto:leave@example.com?subject=stop>"),
+			},
+			"m1": {
+				header("From", "News Team <news@example.com>"),
+				header("List-ID", "Example News <news.example.com>"),
+				header("List-Unsubscribe", "<mailto:leave@example.com>, <"+oneClickURL+">"),
+				header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click"),
+			},
+			"m2": {
+				header("From", "Shop <deals@shop.example.com>"),
+				header("List-Unsubscribe", "<https://shop.example.com/unsubscribe>"),
+			},
+			"m3": {
+				header("From", "Alice <alice@example.com>"),
+			},
+		},
+		order: []string{"m1", "m3", "m2", "m0"},
+	}
+}
+
+func Test_ListSubscriptions(t *testing.T) {
+	f := newFakeSubscriptions(t, "https://news.example.com/u/123")
+	inbox := newFakeInbox(t, f)
+	subs, err := inbox.ListSubscriptions(context.Background(), "newer_than:90d", 0)
+	if err != nil {
+		t.Fatalf("Error listing subscriptions: %v", err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("Expected 2 subscriptions; got %d", len(subs))
+	}
+	news := subs[0]
+	if news.Key != "news.example.com" || news.Count != 2 || news.Sender != "News Team <news@example.com>" {
+		t.Errorf("Unexpected subscription %+v", news)
+	}
+	if !news.LastSeen.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the last seen date to be from the most recent message; got %v", news.LastSeen)
+	}
+	if !news.OneClick || news.UnsubscribeURL != "https://news.example.com/u/123" || news.UnsubscribeMailto != "mailto:leave@example.com" {
+		t.Errorf("Expected the unsubscribe links of the most recent message; got %+v", news)
+	}
+	shop := subs[1]
+	if shop.Key != "deals@shop.example.com" || shop.OneClick || shop.UnsubscribeURL == "" {
+		t.Errorf("Unexpected subscription %+v", shop)
+	}
+	if err := inbox.Unsubscribe(context.Background(), shop, ""); err == nil || !strings.Contains(err.Error(), "open https://shop.example.com/unsubscribe") {
+		t.Errorf("Expected an error asking to open the link; got %v", err)
+	}
+}
+
+func Test_UnsubscribeOneClick(t *testing.T) {
+	var body string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = r.Method + " " + r.Header.Get("Content-Type") + " " + string(b)
+	}))
+	defer server.Close()
+	orig := unsubscribeClient
+	unsubscribeClient = server.Client()
+	defer func() { unsubscribeClient = orig }()
+
+	f := newFakeSubscriptions(t, server.URL+"/u/123")
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+	sub, err := inbox.GetSubscription(ctx, "news.example.com", "newer_than:90d")
+	if err != nil {
+		t.Fatalf("Error getting subscription: %v", err)
+	}
+	if f.queries[0] != "list:news.example.com newer_than:90d" {
+		t.Errorf("Unexpected query %q", f.queries[0])
+	}
+	if err := inbox.Unsubscribe(ctx, sub, ""); err != nil {
+		t.Fatalf("Error unsubscribing: %v", err)
+	}
+	if body != "POST application/x-www-form-urlencoded List-Unsubscribe=One-Click" {
+		t.Errorf("Unexpected one-click request %q", body)
+	}
+	if len(f.sent) != 0 {
+		t.Errorf("Expected no email to be sent")
+	}
+
+	archived, err := inbox.ArchiveSubscription(ctx, sub)
+	if err != nil {
+		t.Fatalf("Error archiving: %v", err)
+	}
+	if archived != 4 || len(f.modified) != 1 || f.modified[0].RemoveLabelIds[0] != "INBOX" {
+		t.Errorf("Expected the messages to be archived; got %d, %+v", archived, f.modified)
+	}
+	if f.queries[1] != "list:news.example.com in:inbox" {
+		t.Errorf("Unexpected archive query %q", f.queries[1])
+	}
+}
+
+func Test_UnsubscribeMailto(t *testing.T) {
+	f := newFakeSubscriptions(t, "")
+	inbox := newFakeInbox(t, f)
+	sub := &Subscription{Key: "news.example.com", UnsubscribeMailto: "mailto:leave@example.com?subject=stop%20it"}
+	if err := inbox.Unsubscribe(context.Background(), sub, ""); err != nil {
+		t.Fatalf("Error unsubscribing: %v", err)
+	}
+	if len(f.sent) != 1 {
+		t.Fatalf("Expected one message to be sent; got %d", len(f.sent))
+	}
+	for _, h := range []string{"To: <leave@example.com>\r\n", "Subject: stop it\r\n"} {
+		if !strings.Contains(f.sent[0], h) {
+			t.Errorf("Expected the message to contain %q; got\n%s", h, f.sent[0])
+		}
+	}
+}
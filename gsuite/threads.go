@@ -0,0 +1,74 @@
+package gsuite
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Thread is a gmail conversation. Messages are in the order gmail returns them which is chronological.
+type Thread struct {
+	ID        string
+	Snippet   string
+	HistoryID uint64
+	Messages  []*Email
+}
+
+// GetThread fetches the thread with the given id including the headers and body of every message in it.
+func (i *Inbox) GetThread(ctx context.Context, threadID string) (*Thread, error) {
+	var t *gmail.Thread
+	err := retry(ctx, func() error {
+		var err error
+		t, err = i.svc.Users.Threads.Get(authUser, threadID).Format("full").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error retrieving thread with id %s", threadID)
+	}
+
+	thread := &Thread{
+		ID:        t.Id,
+		Snippet:   t.Snippet,
+		HistoryID: t.HistoryId,
+		Messages:  make([]*Email, 0, len(t.Messages)),
+	}
+
+	for _, m := range t.Messages {
+		msg, err := newEmail(m)
+		if err != nil {
+			return thread, errors.Wrapf(err, "Error decoding message %s in thread %s", m.Id, threadID)
+		}
+		msg.Labels = i.labelNames(ctx, m.LabelIds)
+		thread.Messages = append(thread.Messages, msg)
+	}
+	return thread, nil
+}
+
+// SearchThreads searches for threads matching the query and returns each matching thread in full along with the
+// token for the next page of results. The token is empty if there are no more results. If any thread can't be
+// fetched it returns the error and no threads.
+func (i *Inbox) SearchThreads(ctx context.Context, query string, maxResults int64, pageToken string) ([]*Thread, string, error) {
+	searchRequest := i.svc.Users.Threads.List(authUser).Q(query).MaxResults(maxResults)
+	if pageToken != "" {
+		searchRequest.PageToken(pageToken)
+	}
+	response, err := searchRequest.Context(ctx).Do()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to search Gmail threads")
+	}
+
+	// The list request only returns the id and snippet of each thread so we need to fetch the messages.
+	results := make([]*Thread, len(response.Threads))
+	errs := make([]error, len(response.Threads))
+	parallel(len(response.Threads), i.fetchWorkers, func(n int) {
+		results[n], errs[n] = i.GetThread(ctx, response.Threads[n].Id)
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return results, response.NextPageToken, nil
+}
@@ -0,0 +1,98 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func Test_GetThread(t *testing.T) {
+	thread := &gmail.Thread{
+		Id: "t1",
+		Messages: []*gmail.Message{
+			{
+				Id: "m1",
+				Payload: &gmail.MessagePart{
+					Headers: []*gmail.MessagePartHeader{{Name: "Subject", Value: "hello"}},
+					Body:    &gmail.MessagePartBody{Data: encodeData("first")},
+				},
+			},
+			{
+				Id: "m2",
+				Payload: &gmail.MessagePart{
+					Headers: []*gmail.MessagePartHeader{{Name: "Subject", Value: "Re: hello"}},
+					Body:    &gmail.MessagePartBody{Data: encodeData("second")},
+				},
+			},
+		},
+	}
+
+	inbox := newFakeInbox(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(thread); err != nil {
+			t.Errorf("Error encoding thread: %v", err)
+		}
+	}))
+
+	actual, err := inbox.GetThread(context.Background(), "t1")
+	if err != nil {
+		t.Fatalf("Error getting thread: %v", err)
+	}
+
+	if len(actual.Messages) != 2 {
+		t.Fatalf("Expected 2 messages; got %d", len(actual.Messages))
+	}
+	for i, expected := range []string{"first", "second"} {
+		if actual.Messages[i].Body != expected {
+			t.Errorf("Message %d: expected body %q; got %q", i, expected, actual.Messages[i].Body)
+		}
+	}
+	if actual.Messages[1].Subject != "Re: hello" {
+		t.Errorf("Expected subject %q; got %q", "Re: hello", actual.Messages[1].Subject)
+	}
+}
+
+func Test_SearchThreads(t *testing.T) {
+	fail := true
+	inbox := newFakeInbox(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/threads"); id {
+		case "":
+			resp = &gmail.ListThreadsResponse{Threads: []*gmail.Thread{{Id: "t1"}, {Id: "t2"}}, NextPageToken: "next"}
+		case "/t2":
+			if fail {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			resp = &gmail.Thread{Id: "t2"}
+		default:
+			resp = &gmail.Thread{Id: strings.TrimPrefix(id, "/")}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("Error encoding response: %v", err)
+		}
+	}))
+
+	threads, _, err := inbox.SearchThreads(context.Background(), "subject:hello", 2, "")
+	if err == nil {
+		t.Errorf("Expected an error for the thread that couldn't be fetched")
+	}
+	if threads != nil {
+		t.Errorf("Expected no threads when a thread can't be fetched; got %+v", threads)
+	}
+
+	fail = false
+	threads, pageToken, err := inbox.SearchThreads(context.Background(), "subject:hello", 2, "")
+	if err != nil {
+		t.Fatalf("Error searching threads: %v", err)
+	}
+	if len(threads) != 2 || threads[0].ID != "t1" || threads[1].ID != "t2" {
+		t.Errorf("Unexpected threads %+v", threads)
+	}
+	if pageToken != "next" {
+		t.Errorf("Expected the next page token; got %q", pageToken)
+	}
+}
@@ -0,0 +1,80 @@
+package gsuite
+
+import (
+	"context"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Vacation is the vacation responder (auto-reply) configuration.
+type Vacation struct {
+	Enabled bool
+	Subject string
+	// TextBody and HTMLBody are the plain text and HTML versions of the reply. Gmail only uses HTMLBody if it is set.
+	TextBody string `json:",omitempty"`
+	HTMLBody string `json:",omitempty"`
+	// Start and End limit when replies are sent. Replies start immediately if Start is zero and continue until the
+	// responder is turned off if End is zero.
+	Start time.Time
+	End   time.Time
+	// ContactsOnly only replies to people in the user's contacts and DomainOnly only replies to people in the
+	// user's domain; DomainOnly is only available to Google Workspace users.
+	ContactsOnly bool
+	DomainOnly   bool
+}
+
+// GetVacation returns the vacation responder configuration.
+func (i *Inbox) GetVacation(ctx context.Context) (*Vacation, error) {
+	s, err := i.svc.Users.Settings.GetVacation(authUser).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get the vacation responder settings")
+	}
+	v := &Vacation{
+		Enabled:      s.EnableAutoReply,
+		Subject:      s.ResponseSubject,
+		TextBody:     s.ResponseBodyPlainText,
+		HTMLBody:     s.ResponseBodyHtml,
+		ContactsOnly: s.RestrictToContacts,
+		DomainOnly:   s.RestrictToDomain,
+	}
+	if s.StartTime != 0 {
+		v.Start = parseEpochMillis(s.StartTime).Local()
+	}
+	if s.EndTime != 0 {
+		v.End = parseEpochMillis(s.EndTime).Local()
+	}
+	return v, nil
+}
+
+// SetVacation replaces the vacation responder configuration.
+func (i *Inbox) SetVacation(ctx context.Context, v *Vacation) error {
+	log := util.LoggerFromContext(ctx)
+	if v.Enabled && v.TextBody == "" && v.HTMLBody == "" {
+		return errors.New("The vacation responder needs a body to turn it on")
+	}
+	if !v.Start.IsZero() && !v.End.IsZero() && !v.End.After(v.Start) {
+		return errors.Errorf("The vacation responder's end %v must be after its start %v", v.End, v.Start)
+	}
+	s := &gmail.VacationSettings{
+		EnableAutoReply:       v.Enabled,
+		ResponseSubject:       v.Subject,
+		ResponseBodyPlainText: v.TextBody,
+		ResponseBodyHtml:      v.HTMLBody,
+		RestrictToContacts:    v.ContactsOnly,
+		RestrictToDomain:      v.DomainOnly,
+	}
+	if !v.Start.IsZero() {
+		s.StartTime = v.Start.UnixMilli()
+	}
+	if !v.End.IsZero() {
+		s.EndTime = v.End.UnixMilli()
+	}
+	if _, err := i.svc.Users.Settings.UpdateVacation(authUser, s).Context(ctx).Do(); err != nil {
+		return errors.Wrapf(err, "Failed to update the vacation responder settings")
+	}
+	log.Info("Updated the vacation responder", "enabled", v.Enabled, "start", v.Start, "end", v.End)
+	return nil
+}
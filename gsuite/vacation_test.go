@@ -0,0 +1,92 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// fakeVacation is a fake implementation of the vacation settings API.
+type fakeVacation struct {
+	t        *testing.T
+	settings *gmail.VacationSettings
+}
+
+func (f *fakeVacation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/gmail/v1/users/me/settings/vacation" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodPut {
+		f.settings = &gmail.VacationSettings{}
+		if err := json.NewDecoder(r.Body).Decode(f.settings); err != nil {
+			f.t.Errorf("Error decoding settings: %v", err)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(f.settings); err != nil {
+		f.t.Errorf("Error encoding response: %v", err)
+	}
+}
+
+func Test_Vacation(t *testing.T) {
+	f := &fakeVacation{t: t, settings: &gmail.VacationSettings{}}
+	inbox := newFakeInbox(t, f)
+	ctx := context.Background()
+
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local)
+	v := &Vacation{
+		Enabled:      true,
+		Subject:      "Out of office",
+		TextBody:     "Back on July 8",
+		Start:        start,
+		End:          start.AddDate(0, 0, 7),
+		ContactsOnly: true,
+	}
+	if err := inbox.SetVacation(ctx, v); err != nil {
+		t.Fatalf("Error setting vacation: %v", err)
+	}
+	if f.settings.StartTime != start.UnixMilli() || !f.settings.RestrictToContacts || f.settings.RestrictToDomain {
+		t.Errorf("Unexpected settings %+v", f.settings)
+	}
+
+	actual, err := inbox.GetVacation(ctx)
+	if err != nil {
+		t.Fatalf("Error getting vacation: %v", err)
+	}
+	if !actual.Enabled || actual.Subject != v.Subject || actual.TextBody != v.TextBody || !actual.Start.Equal(v.Start) || !actual.End.Equal(v.End) {
+		t.Errorf("Got %+v; want %+v", actual, v)
+	}
+
+	actual.Enabled = false
+	actual.End = time.Time{}
+	if err := inbox.SetVacation(ctx, actual); err != nil {
+		t.Fatalf("Error turning vacation off: %v", err)
+	}
+	if f.settings.EnableAutoReply || f.settings.EndTime != 0 || f.settings.ResponseSubject != v.Subject {
+		t.Errorf("Expected the responder to be off and keep its message; got %+v", f.settings)
+	}
+}
+
+func Test_SetVacationInvalid(t *testing.T) {
+	inbox := newFakeInbox(t, &fakeVacation{t: t, settings: &gmail.VacationSettings{}})
+	now := time.Now()
+	type testCase struct {
+		name     string
+		vacation *Vacation
+	}
+	cases := []testCase{
+		{name: "no-body", vacation: &Vacation{Enabled: true, Subject: "Away"}},
+		{name: "end-before-start", vacation: &Vacation{Enabled: true, TextBody: "Away", Start: now, End: now.Add(-time.Hour)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := inbox.SetVacation(context.Background(), c.vacation); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
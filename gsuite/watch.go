@@ -0,0 +1,294 @@
+package gsuite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlewi/gctl/util"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// Types of WatchEvent.
+const (
+	EventAdded         = "added"
+	EventLabelsChanged = "labelsChanged"
+	EventDeleted       = "deleted"
+)
+
+// defaultWatchInterval is how often the history is polled if WatchOptions doesn't set it.
+const defaultWatchInterval = time.Minute
+
+// WatchEvent is emitted by Watch for every message that changed.
+type WatchEvent struct {
+	// Type is one of EventAdded, EventLabelsChanged or EventDeleted.
+	Type      string `json:"type"`
+	MessageID string `json:"messageId"`
+	// HistoryID is the history id the mailbox was at after the change.
+	HistoryID uint64 `json:"historyId"`
+	// Message is the message that changed. It is nil for deleted messages.
+	Message *EmailInfo `json:"message,omitempty"`
+}
+
+// EventHandler is called by Watch for each event.
+type EventHandler func(ctx context.Context, event *WatchEvent) error
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Query restricts the events to messages matching it. Deleted messages can't be matched against the query so
+	// they are only reported if the query is empty.
+	Query string
+	// Interval is how often to poll for changes. Defaults to a minute.
+	Interval time.Duration
+	// CheckpointFile stores the history id the watch has processed so a restarted watch picks up where it stopped.
+	// If it is empty or the file doesn't exist the watch starts from the current state of the mailbox.
+	CheckpointFile string
+}
+
+// Watch polls the mailbox's history and calls handler for each message that was added, deleted or whose labels
+// changed. It runs until ctx is cancelled. Errors returned by handler are logged and don't stop the watch.
+//
+// If the checkpoint is too old for gmail's history the watch restarts from the current state of the mailbox and
+// changes in between are missed.
+func (i *Inbox) Watch(ctx context.Context, opts WatchOptions, handler EventHandler) error {
+	log := util.LoggerFromContext(ctx)
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	historyID, err := readCheckpoint(opts.CheckpointFile)
+	if err != nil {
+		return err
+	}
+	if historyID == 0 {
+		historyID, err = i.HistoryID(ctx)
+		if err != nil {
+			return err
+		}
+		if err := writeCheckpoint(opts.CheckpointFile, historyID); err != nil {
+			return err
+		}
+	}
+	log.Info("Watching for changes", "historyId", historyID, "query", opts.Query, "interval", interval)
+
+	for {
+		next, err := i.pollHistory(ctx, historyID, opts.Query, handler)
+		switch {
+		case err == ErrHistoryExpired:
+			log.Info("Gmail history has expired; changes since the checkpoint will be missed", "historyId", historyID)
+			next, err = i.HistoryID(ctx)
+			if err != nil {
+				log.Error(err, "Failed to get the current history id")
+			}
+		case err != nil:
+			// Transient errors shouldn't end a long running watch; the next poll retries from the same checkpoint.
+			log.Error(err, "Failed to poll the gmail history", "historyId", historyID)
+		}
+		if err == nil && next != historyID {
+			historyID = next
+			if err := writeCheckpoint(opts.CheckpointFile, historyID); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pollHistory calls handler for the changes since historyID and returns the history id to poll from next.
+func (i *Inbox) pollHistory(ctx context.Context, historyID uint64, query string, handler EventHandler) (uint64, error) {
+	log := util.LoggerFromContext(ctx)
+	changes, err := i.ListHistory(ctx, historyID)
+	if err != nil {
+		return historyID, err
+	}
+
+	events := make([]*WatchEvent, 0, len(changes.Added)+len(changes.LabelsChanged)+len(changes.Deleted))
+	ids := append(append([]string{}, changes.Added...), changes.LabelsChanged...)
+	// If a message can't be fetched we don't advance past it so the next poll retries it rather than losing it.
+	infos, err := i.fetchChanged(ctx, ids)
+	if err != nil {
+		return historyID, err
+	}
+	if query != "" {
+		infos, err = i.filterInfos(ctx, infos, query)
+		if err != nil {
+			return historyID, err
+		}
+	}
+	added := make(map[string]bool, len(changes.Added))
+	for _, id := range changes.Added {
+		added[id] = true
+	}
+	for _, info := range infos {
+		eventType := EventLabelsChanged
+		if added[info.ID] {
+			eventType = EventAdded
+		}
+		events = append(events, &WatchEvent{Type: eventType, MessageID: info.ID, HistoryID: changes.HistoryID, Message: info})
+	}
+	if query == "" {
+		for _, id := range changes.Deleted {
+			events = append(events, &WatchEvent{Type: EventDeleted, MessageID: id, HistoryID: changes.HistoryID})
+		}
+	}
+
+	for _, e := range events {
+		if err := handler(ctx, e); err != nil {
+			log.Error(err, "Failed to handle event", "type", e.Type, "messageId", e.MessageID)
+		}
+	}
+	return changes.HistoryID, nil
+}
+
+// fetchChanged fetches the messages that changed. Messages that were deleted since they changed are skipped. If
+// any other message can't be fetched it returns an error.
+func (i *Inbox) fetchChanged(ctx context.Context, ids []string) ([]*EmailInfo, error) {
+	log := util.LoggerFromContext(ctx)
+	results := make([]*EmailInfo, len(ids))
+	errs := make([]error, len(ids))
+	parallel(len(ids), i.fetchWorkers, func(n int) {
+		results[n], errs[n] = i.getInfo(ctx, ids[n], i.extraHeaders)
+	})
+
+	infos := make([]*EmailInfo, 0, len(ids))
+	for n, err := range errs {
+		if err == nil {
+			infos = append(infos, results[n])
+			continue
+		}
+		if gErr, ok := errors.Cause(err).(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			log.Info("Message was deleted before it could be fetched", "messageId", ids[n])
+			continue
+		}
+		return nil, err
+	}
+	return infos, nil
+}
+
+// filterBatchSize is the number of messages matched against the query by each search in filterInfos.
+const filterBatchSize = 50
+
+// filterInfos returns the messages that match query. Gmail can't search for specific message ids so it searches
+// for the messages matching the query with the Message-Id headers of the changed messages and intersects the
+// results. Messages without a Message-Id header can't be matched and are dropped.
+func (i *Inbox) filterInfos(ctx context.Context, infos []*EmailInfo, query string) ([]*EmailInfo, error) {
+	log := util.LoggerFromContext(ctx)
+	withIDs := make([]*EmailInfo, 0, len(infos))
+	for _, info := range infos {
+		if strings.Trim(info.MessageID, "<> ") == "" {
+			log.Info("Message doesn't have a Message-Id header so it can't be matched against the query", "messageId", info.ID)
+			continue
+		}
+		withIDs = append(withIDs, info)
+	}
+
+	matched := map[string]bool{}
+	for start := 0; start < len(withIDs); start += filterBatchSize {
+		batch := withIDs[start:min(start+filterBatchSize, len(withIDs))]
+		terms := make([]*Query, 0, len(batch))
+		for _, info := range batch {
+			terms = append(terms, NewQuery().Raw("rfc822msgid:"+quoteQueryValue(strings.Trim(info.MessageID, "<> "))))
+		}
+		q := NewQuery().Raw("(" + query + ")").Or(terms...).String()
+		ids, _, err := i.listMessageIDs(ctx, q, 0, "", false)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			matched[id] = true
+		}
+	}
+
+	filtered := make([]*EmailInfo, 0, len(infos))
+	for _, info := range withIDs {
+		if matched[info.ID] {
+			filtered = append(filtered, info)
+		}
+	}
+	return filtered, nil
+}
+
+// readCheckpoint returns the history id stored in path or 0 if there isn't one.
+func readCheckpoint(path string) (uint64, error) {
+	if path == "" {
+		return 0, nil
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to read checkpoint %s", path)
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Checkpoint %s doesn't contain a valid history id", path)
+	}
+	return id, nil
+}
+
+// writeCheckpoint saves the history id to path. It does nothing if path is empty.
+func writeCheckpoint(path string, historyID uint64) error {
+	if path == "" {
+		return nil
+	}
+	return writeFileAtomic(path, []byte(strconv.FormatUint(historyID, 10)+"\n"))
+}
+
+// CommandHook returns an EventHandler that runs command with the shell for each event. The event is written to
+// the command's stdin as JSON and its type and message id are in the GCTL_EVENT_TYPE and GCTL_MESSAGE_ID
+// environment variables.
+func CommandHook(command string) EventHandler {
+	return func(ctx context.Context, event *WatchEvent) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal event")
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(b)
+		cmd.Env = append(os.Environ(), "GCTL_EVENT_TYPE="+event.Type, "GCTL_MESSAGE_ID="+event.MessageID)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.Wrapf(err, "Command %q failed; output:\n%s", command, out)
+		}
+		return nil
+	}
+}
+
+// WebhookHook returns an EventHandler that POSTs each event as JSON to url.
+func WebhookHook(url string) EventHandler {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return func(ctx context.Context, event *WatchEvent) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal event")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create request to %s", url)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to POST event to %s", url)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return errors.Errorf("POST to %s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,189 @@
+package gsuite
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// newWatchMailbox returns a fake mailbox whose history since 100 has an added, a relabeled and a deleted message.
+func newWatchMailbox(t *testing.T) *fakeMailbox {
+	return &fakeMailbox{
+		t: t,
+		messages: map[string][]string{
+			"m0": {"INBOX"},
+			"m4": {"INBOX", "UNREAD"},
+		},
+		historyStart: 100,
+		historyID:    105,
+		history: []*gmail.History{
+			{LabelsAdded: []*gmail.HistoryLabelAdded{{Message: &gmail.Message{Id: "m0"}}}},
+			{MessagesDeleted: []*gmail.HistoryMessageDeleted{{Message: &gmail.Message{Id: "m1"}}}},
+			{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "m4"}}}},
+		},
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	f := newWatchMailbox(t)
+	inbox := newFakeInbox(t, f)
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+	if err := os.WriteFile(checkpoint, []byte("100\n"), 0o600); err != nil {
+		t.Fatalf("Error writing checkpoint: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make([]*WatchEvent, 0)
+	handler := func(ctx context.Context, e *WatchEvent) error {
+		events = append(events, e)
+		if len(events) == 3 {
+			cancel()
+		}
+		return nil
+	}
+	opts := WatchOptions{Interval: time.Hour, CheckpointFile: checkpoint}
+	if err := inbox.Watch(ctx, opts, handler); err != nil {
+		t.Fatalf("Error watching: %v", err)
+	}
+
+	expected := []string{"added m4", "labelsChanged m0", "deleted m1"}
+	actual := make([]string, 0, len(events))
+	for _, e := range events {
+		actual = append(actual, e.Type+" "+e.MessageID)
+		if e.HistoryID != 105 {
+			t.Errorf("Expected history id 105; got %d", e.HistoryID)
+		}
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Got events %v; want %v", actual, expected)
+	}
+	if events[0].Message == nil || events[0].Message.Subject != "Subject of m4" {
+		t.Errorf("Expected the added event to include the message; got %+v", events[0].Message)
+	}
+
+	id, err := readCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatalf("Error reading checkpoint: %v", err)
+	}
+	if id != 105 {
+		t.Errorf("Expected the checkpoint to advance to 105; got %d", id)
+	}
+}
+
+func Test_pollHistoryQuery(t *testing.T) {
+	f := newWatchMailbox(t)
+	f.matching = []string{"m4"}
+	inbox := newFakeInbox(t, f)
+
+	events := make([]*WatchEvent, 0)
+	next, err := inbox.pollHistory(context.Background(), 100, "from:alice", func(ctx context.Context, e *WatchEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error polling: %v", err)
+	}
+	if next != 105 {
+		t.Errorf("Expected the next history id to be 105; got %d", next)
+	}
+	if len(events) != 1 || events[0].MessageID != "m4" {
+		t.Errorf("Expected only the matching message; got %+v", events)
+	}
+	expected := "(from:alice) (rfc822msgid:m4@example.com OR rfc822msgid:m0@example.com)"
+	if len(f.queries) != 1 || f.queries[0] != expected {
+		t.Errorf("Expected the changed messages to be matched by Message-Id; got %v", f.queries)
+	}
+}
+
+func Test_pollHistoryFetchError(t *testing.T) {
+	f := newWatchMailbox(t)
+	// m4 was added but can't be fetched.
+	f.fail = map[string]bool{"m4": true}
+	inbox := newFakeInbox(t, f)
+
+	events := 0
+	next, err := inbox.pollHistory(context.Background(), 100, "", func(ctx context.Context, e *WatchEvent) error {
+		events++
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("Expected an error when a changed message can't be fetched")
+	}
+	if next != 100 || events != 0 {
+		t.Errorf("Expected the history id not to advance and no events; got %d and %d events", next, events)
+	}
+}
+
+func Test_pollHistoryExpired(t *testing.T) {
+	f := newWatchMailbox(t)
+	f.expired = true
+	inbox := newFakeInbox(t, f)
+	_, err := inbox.pollHistory(context.Background(), 100, "", func(ctx context.Context, e *WatchEvent) error {
+		return nil
+	})
+	if err != ErrHistoryExpired {
+		t.Errorf("Expected ErrHistoryExpired; got %v", err)
+	}
+}
+
+func Test_CommandHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	hook := CommandHook(`cat > "$OUT"; echo "$GCTL_EVENT_TYPE $GCTL_MESSAGE_ID" >> "$OUT"`)
+	t.Setenv("OUT", out)
+
+	event := &WatchEvent{Type: EventAdded, MessageID: "m1", HistoryID: 10}
+	if err := hook(context.Background(), event); err != nil {
+		t.Fatalf("Error running hook: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Error reading output: %v", err)
+	}
+	expected := `{"type":"added","messageId":"m1","historyId":10}added m1` + "\n"
+	if string(b) != expected {
+		t.Errorf("Got %q; want %q", string(b), expected)
+	}
+
+	if err := CommandHook("exit 3")(context.Background(), event); err == nil {
+		t.Errorf("Expected an error when the command fails")
+	}
+}
+
+func Test_WebhookHook(t *testing.T) {
+	var received *WatchEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		received = &WatchEvent{}
+		if err := json.Unmarshal(b, received); err != nil {
+			t.Errorf("Error decoding event: %v", err)
+		}
+		if received.MessageID == "bad" {
+			http.Error(w, "bad", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	hook := WebhookHook(server.URL)
+	if err := hook(context.Background(), &WatchEvent{Type: EventDeleted, MessageID: "m1"}); err != nil {
+		t.Fatalf("Error calling webhook: %v", err)
+	}
+	if received == nil || received.Type != EventDeleted || received.MessageID != "m1" {
+		t.Errorf("Unexpected event %+v", received)
+	}
+	if err := hook(context.Background(), &WatchEvent{MessageID: "bad"}); err == nil {
+		t.Errorf("Expected an error when the webhook fails")
+	}
+}